@@ -0,0 +1,187 @@
+package bond
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/pkg/errors"
+)
+
+// mysqlMaxLockName is the maximum length of a MySQL lock name.
+const mysqlMaxLockName = 64
+
+// WithAdvisoryLock runs fn while holding the advisory lock with the given
+// name, waiting for the lock if another session holds it. Advisory locks
+// are PostgreSQL and MySQL only, they're commonly used to make sure a job
+// runs once across the instances of an application.
+//
+// Within a transaction the lock is transaction-scoped on PostgreSQL: it's
+// held until the transaction ends, even after fn returns. On MySQL it's
+// released once fn returns. Outside of a transaction the lock is taken on a
+// connection pinned from the pool for as long as fn runs, fn itself runs on
+// the session's pool so the pool must allow one more connection than fn
+// needs. The lock is released when fn returns, the pinned connection is
+// discarded if it can't be released.
+func (s *session) WithAdvisoryLock(ctx context.Context, name string, fn func(sess Session) error) error {
+	locked, err := s.advisoryLock(ctx, name, true, fn)
+	if err == nil && !locked {
+		return errors.Wrapf(ErrAdvisoryLockNotAcquired, "bond: %q", name)
+	}
+	return err
+}
+
+// TryAdvisoryLock is like WithAdvisoryLock but doesn't wait for the lock, it
+// returns false without running fn when another session holds it.
+func (s *session) TryAdvisoryLock(ctx context.Context, name string, fn func(sess Session) error) (bool, error) {
+	return s.advisoryLock(ctx, name, false, fn)
+}
+
+func (s *session) advisoryLock(ctx context.Context, name string, wait bool, fn func(sess Session) error) (bool, error) {
+	if ctx == nil {
+		ctx = s.Context()
+	}
+	d, err := dialect(s)
+	if err != nil {
+		return false, err
+	}
+	if d != dialectPostgreSQL && d != dialectMySQL {
+		return false, errors.Errorf("bond: advisory locks are not supported by %s", d)
+	}
+
+	sess := s.WithContext(ctx).(*session)
+	if sess.inTx() {
+		return sess.txAdvisoryLock(d, name, wait, fn)
+	}
+	return sess.connAdvisoryLock(ctx, d, name, wait, fn)
+}
+
+// advisoryLockKey returns the PostgreSQL advisory lock key of name.
+func advisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// mysqlLockName returns the MySQL lock name of name, long names are hashed.
+func mysqlLockName(name string) string {
+	if len(name) <= mysqlMaxLockName {
+		return name
+	}
+	return fmt.Sprintf("bond:%x", uint64(advisoryLockKey(name)))
+}
+
+// advisoryLockQueries returns the queries that take and release the lock
+// with the given name, and their argument. Queries of transactions go
+// through the session and use its placeholders, the ones of pinned
+// connections use the placeholders of the driver. Transaction-scoped
+// PostgreSQL locks have no unlock query.
+func advisoryLockQueries(d, name string, wait, tx bool) (lock, unlock string, arg interface{}) {
+	if d == dialectMySQL {
+		timeout := "0"
+		if wait {
+			timeout = "-1"
+		}
+		return "SELECT GET_LOCK(?, " + timeout + ") = 1", "SELECT RELEASE_LOCK(?) = 1", mysqlLockName(name)
+	}
+
+	ph := "$1"
+	if tx {
+		ph = "?"
+	}
+	// pg_advisory_lock and pg_advisory_xact_lock return void, the queries
+	// return true once they do.
+	switch {
+	case tx && wait:
+		lock = "SELECT true FROM (SELECT pg_advisory_xact_lock(" + ph + ")) l"
+	case tx:
+		lock = "SELECT pg_try_advisory_xact_lock(" + ph + ")"
+	case wait:
+		lock = "SELECT true FROM (SELECT pg_advisory_lock(" + ph + ")) l"
+	default:
+		lock = "SELECT pg_try_advisory_lock(" + ph + ")"
+	}
+	if !tx {
+		unlock = "SELECT pg_advisory_unlock(" + ph + ")"
+	}
+	return lock, unlock, advisoryLockKey(name)
+}
+
+// txAdvisoryLock takes the lock within the session's transaction.
+func (s *session) txAdvisoryLock(d, name string, wait bool, fn func(sess Session) error) (bool, error) {
+	lock, unlock, arg := advisoryLockQueries(d, name, wait, true)
+
+	var locked bool
+	row, err := s.QueryRow(lock, arg)
+	if err == nil {
+		err = row.Scan(&locked)
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "bond: acquiring advisory lock %q", name)
+	}
+	if !locked {
+		return false, nil
+	}
+
+	err = fn(s)
+	if unlock != "" {
+		if _, uErr := s.Exec(unlock, arg); uErr != nil && err == nil {
+			err = errors.Wrapf(uErr, "bond: releasing advisory lock %q", name)
+		}
+	}
+	return true, err
+}
+
+// connAdvisoryLock takes the lock on a connection pinned from the session's
+// pool.
+func (s *session) connAdvisoryLock(ctx context.Context, d, name string, wait bool, fn func(sess Session) error) (bool, error) {
+	sqlDB, ok := s.Driver().(*sql.DB)
+	if !ok {
+		return false, errors.Errorf("bond: can't pin a connection of a %T", s.Driver())
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	lock, unlock, arg := advisoryLockQueries(d, name, wait, false)
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, lock, arg).Scan(&locked); err != nil {
+		// The lock may have been taken right before the query was
+		// canceled, the connection can't go back to the pool.
+		discardConn(conn)
+		return false, errors.Wrapf(err, "bond: acquiring advisory lock %q", name)
+	}
+	if !locked {
+		if wait {
+			// Waiting for the lock can't fail quietly, don't trust the
+			// connection.
+			discardConn(conn)
+		}
+		return false, nil
+	}
+
+	err = fn(s)
+
+	// The lock must be released even if ctx is done.
+	var unlocked bool
+	if uErr := conn.QueryRowContext(context.Background(), unlock, arg).Scan(&unlocked); uErr != nil || !unlocked {
+		discardConn(conn)
+		if uErr != nil && err == nil {
+			err = errors.Wrapf(uErr, "bond: releasing advisory lock %q", name)
+		}
+	}
+	return true, err
+}
+
+// discardConn closes conn instead of returning it to the pool, so the
+// advisory locks it may hold are released by the database.
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(interface{}) error {
+		return driver.ErrBadConn
+	})
+}
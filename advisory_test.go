@@ -0,0 +1,96 @@
+package bond_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+)
+
+func TestAdvisoryLock(t *testing.T) {
+	ctx := context.Background()
+
+	ran := false
+	err := DB.WithAdvisoryLock(ctx, "bond_test:job", func(sess bond.Session) error {
+		ran = true
+
+		// The lock is held by another connection.
+		ok, err := DB.TryAdvisoryLock(ctx, "bond_test:job", func(bond.Session) error {
+			t.Error("lock acquired twice")
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		ok, err = DB.TryAdvisoryLock(ctx, "bond_test:other", func(bond.Session) error {
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, ran)
+
+	// Errors of fn are returned and the lock is released.
+	fail := errors.New("fail")
+	err = DB.WithAdvisoryLock(ctx, "bond_test:job", func(bond.Session) error {
+		return fail
+	})
+	assert.Equal(t, fail, err)
+
+	ok, err := DB.TryAdvisoryLock(ctx, "bond_test:job", func(bond.Session) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// Within a transaction WithAdvisoryLock holds the lock after fn returns,
+	// until the transaction ends.
+	ran = false
+	err = DB.SessionTx(ctx, func(tx bond.Session) error {
+		err := tx.WithAdvisoryLock(ctx, "bond_test:tx", func(bond.Session) error {
+			ran = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		ok, err := DB.TryAdvisoryLock(ctx, "bond_test:tx", func(bond.Session) error {
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, ran)
+
+	// TryAdvisoryLock within a transaction holds the lock until the
+	// transaction ends too.
+	tx, err := DB.NewSessionTx(ctx)
+	assert.NoError(t, err)
+
+	ok, err = tx.TryAdvisoryLock(ctx, "bond_test:tx", func(bond.Session) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = DB.TryAdvisoryLock(ctx, "bond_test:tx", func(bond.Session) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, tx.TxRollback())
+
+	ok, err = DB.TryAdvisoryLock(ctx, "bond_test:tx", func(bond.Session) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
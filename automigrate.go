@@ -0,0 +1,390 @@
+package bond
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"upper.io/db.v3"
+	"upper.io/db.v3/lib/reflectx"
+)
+
+// AutoMigrate creates the tables of the given models and adds the columns
+// missing from existing tables. Columns are never altered nor dropped.
+//
+// Column types are inferred from field types and can be tuned with the bond
+// struct tag:
+//
+//	Email string `db:"email" bond:"size=320,unique"`
+//	Plan  string `db:"plan" bond:"index,default='free'"`
+//	Meta  []byte `db:"meta" bond:"type=jsonb,null"`
+//
+// Fields that aren't pointers are NOT NULL unless tagged with null. Columns
+// added to existing tables are NOT NULL only when they have a default.
+// Models implementing PrimaryKeys() []string declare their primary keys,
+// otherwise the "id" column is the primary key. A single integer primary key
+// is auto-incremented.
+//
+// On PostgreSQL, which has transactional DDL, the statements run within a
+// transaction (the session's own, if it is one) so that a failed migration
+// leaves the schema untouched.
+func AutoMigrate(sess Session, models ...Model) error {
+	statements, err := autoMigrate(sess, models)
+	if err != nil {
+		return err
+	}
+
+	run := func(sess Session) error {
+		for _, stmt := range statements {
+			if _, err := sess.Exec(stmt); err != nil {
+				return errors.Wrapf(err, "bond: %s", stmt)
+			}
+		}
+		return nil
+	}
+	if d, _ := dialect(sess); d != dialectPostgreSQL {
+		return run(sess)
+	}
+	if tx, ok := sess.(hasTx); ok && tx.inTx() {
+		return run(sess)
+	}
+	return sess.SessionTx(nil, run)
+}
+
+// AutoMigrateDryRun writes the statements AutoMigrate would run to w, one per
+// line, without running them.
+func AutoMigrateDryRun(sess Session, w io.Writer, models ...Model) error {
+	statements, err := autoMigrate(sess, models)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range statements {
+		if _, err := fmt.Fprintf(w, "%s;\n", stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type columnDef struct {
+	name     string
+	typ      reflect.Type
+	nullable bool
+	size     string
+	sqlType  string
+	def      string
+	unique   bool
+	index    bool
+	autoIncr bool
+}
+
+func autoMigrate(sess Session, models []Model) ([]string, error) {
+	d, err := dialect(sess)
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []string
+	for _, model := range models {
+		name := model.Store(sess).Name()
+		schema, table := qualifiedTable(sess, name)
+		columns, pKeys, err := columnDefs(model)
+		if err != nil {
+			return nil, err
+		}
+
+		var stmts []string
+		existing, err := Describe(sess, name)
+		switch {
+		case errors.Cause(err) == db.ErrCollectionDoesNotExist:
+			stmts, err = createTable(d, schema, table, columns, pKeys)
+		case err == nil:
+			stmts, err = addColumns(d, schema, table, &existing[0], columns)
+		}
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, stmts...)
+	}
+	return statements, nil
+}
+
+func columnDefs(model Model) ([]columnDef, []string, error) {
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, nil, ErrExpectingPointerToStruct
+	}
+
+	columns, err := structColumnDefs(t)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pKeys []string
+	if pk, ok := model.(hasPrimaryKeys); ok {
+		pKeys = pk.PrimaryKeys()
+	} else {
+		for _, c := range columns {
+			if c.name == "id" {
+				pKeys = []string{"id"}
+			}
+		}
+	}
+
+	for i := range columns {
+		c := &columns[i]
+		for _, pKey := range pKeys {
+			if c.name == pKey {
+				c.nullable = false
+			}
+		}
+		if len(pKeys) == 1 && c.name == pKeys[0] && c.sqlType == "" && isInteger(c.typ.Kind()) {
+			c.autoIncr = true
+		}
+	}
+	return columns, pKeys, nil
+}
+
+func structColumnDefs(t reflect.Type) ([]columnDef, error) {
+	var columns []columnDef
+	for _, fi := range columnFields(t) {
+		ft := fi.Field.Type
+		c := columnDef{name: fi.Name, typ: reflectx.Deref(ft), nullable: ft.Kind() == reflect.Ptr}
+		if err := c.parseTag(fi.Field.Tag.Get("bond")); err != nil {
+			return nil, errors.Wrapf(err, "bond: field %s.%s", t.Name(), fi.Field.Name)
+		}
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+// parseTag reads the options of a bond tag. Defaults may contain commas
+// within parentheses or quotes, e.g. default='a,b'.
+func (c *columnDef) parseTag(tag string) error {
+	for tag != "" {
+		opt := tag
+		if i := optionEnd(tag); i >= 0 {
+			opt, tag = tag[:i], tag[i+1:]
+		} else {
+			tag = ""
+		}
+
+		key, value := opt, ""
+		if i := strings.Index(opt, "="); i >= 0 {
+			key, value = opt[:i], opt[i+1:]
+		}
+		switch strings.TrimSpace(key) {
+		case "size":
+			c.size = value
+		case "type":
+			c.sqlType = value
+		case "default":
+			c.def = value
+		case "unique":
+			c.unique = true
+		case "index":
+			c.index = true
+		case "null":
+			c.nullable = true
+		default:
+			return errors.Errorf("unknown bond tag option %q", key)
+		}
+	}
+	return nil
+}
+
+// optionEnd returns the index of the comma that ends the first option of
+// tag, or -1 if the option spans the whole tag.
+func optionEnd(tag string) int {
+	depth, quoted := 0, false
+	for i, r := range tag {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case quoted:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// sqlTypeOf returns the column type of c in the given dialect.
+func (c *columnDef) sqlTypeOf(d string) (string, error) {
+	if c.sqlType != "" {
+		return c.sqlType, nil
+	}
+
+	if c.autoIncr {
+		switch d {
+		case dialectPostgreSQL:
+			if c.typ.Kind() == reflect.Int64 || c.typ.Kind() == reflect.Uint64 {
+				return "BIGSERIAL", nil
+			}
+			return "SERIAL", nil
+		case dialectSQLite:
+			return "INTEGER", nil
+		}
+	}
+
+	switch {
+	case c.typ == timeType:
+		if d == dialectPostgreSQL {
+			return "TIMESTAMP WITH TIME ZONE", nil
+		}
+		return "DATETIME", nil
+	case c.typ.ConvertibleTo(bytesType) && c.typ.Kind() == reflect.Slice:
+		if d == dialectPostgreSQL {
+			return "BYTEA", nil
+		}
+		return "BLOB", nil
+	}
+
+	switch c.typ.Kind() {
+	case reflect.Bool:
+		return "BOOLEAN", nil
+	case reflect.Int8, reflect.Int16, reflect.Uint8, reflect.Uint16:
+		return "SMALLINT", nil
+	case reflect.Int, reflect.Int32, reflect.Uint, reflect.Uint32:
+		return "INTEGER", nil
+	case reflect.Int64, reflect.Uint64:
+		if d == dialectSQLite {
+			return "INTEGER", nil
+		}
+		return "BIGINT", nil
+	case reflect.Float32:
+		return "REAL", nil
+	case reflect.Float64:
+		switch d {
+		case dialectMySQL:
+			return "DOUBLE", nil
+		case dialectSQLite:
+			return "REAL", nil
+		}
+		return "DOUBLE PRECISION", nil
+	case reflect.String:
+		if c.size != "" {
+			return "VARCHAR(" + c.size + ")", nil
+		}
+		if d == dialectMySQL {
+			return "VARCHAR(255)", nil
+		}
+		return "TEXT", nil
+	}
+	return "", errors.Errorf("bond: can't infer the column type of %s (%v), use the type tag option", c.name, c.typ)
+}
+
+// definition returns the definition of c within CREATE TABLE or ADD COLUMN.
+func (c *columnDef) definition(d string, notNull bool) (string, error) {
+	typ, err := c.sqlTypeOf(d)
+	if err != nil {
+		return "", err
+	}
+
+	def := quoteIdent(d, c.name) + " " + typ
+	if notNull {
+		def += " NOT NULL"
+	}
+	if c.def != "" {
+		def += " DEFAULT " + c.def
+	}
+	if c.autoIncr && d == dialectMySQL {
+		def += " AUTO_INCREMENT"
+	}
+	return def, nil
+}
+
+func createTable(d, schema, table string, columns []columnDef, pKeys []string) ([]string, error) {
+	defs := make([]string, 0, len(columns)+1)
+	for i := range columns {
+		c := &columns[i]
+		def, err := c.definition(d, !c.nullable)
+		if err != nil {
+			return nil, err
+		}
+		if c.autoIncr && d == dialectSQLite {
+			// SQLite only auto-increments INTEGER PRIMARY KEY columns.
+			def += " PRIMARY KEY AUTOINCREMENT"
+			pKeys = nil
+		}
+		defs = append(defs, def)
+	}
+	if len(pKeys) > 0 {
+		quoted := make([]string, len(pKeys))
+		for i, pKey := range pKeys {
+			quoted[i] = quoteIdent(d, pKey)
+		}
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(quoted, ", ")+")")
+	}
+
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE %s (\n  %s\n)", quoteTable(d, schema, table), strings.Join(defs, ",\n  ")),
+	}
+	return append(statements, indexes(d, schema, table, columns)...), nil
+}
+
+func addColumns(d, schema, table string, existing *Table, columns []columnDef) ([]string, error) {
+	var statements []string
+	var added []columnDef
+	for i := range columns {
+		c := &columns[i]
+		if existing.Column(c.name) != nil {
+			continue
+		}
+		def, err := c.definition(d, !c.nullable && c.def != "")
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", quoteTable(d, schema, table), def))
+		added = append(added, *c)
+	}
+	return append(statements, indexes(d, schema, table, added)...), nil
+}
+
+func indexes(d, schema, table string, columns []columnDef) []string {
+	var statements []string
+	for _, c := range columns {
+		switch {
+		case c.unique:
+			statements = append(statements, fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s)",
+				quoteIdent(d, table+"_"+c.name+"_key"), quoteTable(d, schema, table), quoteIdent(d, c.name)))
+		case c.index:
+			statements = append(statements, fmt.Sprintf("CREATE INDEX %s ON %s (%s)",
+				quoteIdent(d, table+"_"+c.name+"_idx"), quoteTable(d, schema, table), quoteIdent(d, c.name)))
+		}
+	}
+	return statements
+}
+
+// quoteTable quotes table, qualified with schema if there's one.
+func quoteTable(d, schema, table string) string {
+	if schema == "" {
+		return quoteIdent(d, table)
+	}
+	return quoteIdent(d, schema) + "." + quoteIdent(d, table)
+}
+
+func quoteIdent(d, name string) string {
+	if d == dialectMySQL {
+		return "`" + strings.Replace(name, "`", "``", -1) + "`"
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func isInteger(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
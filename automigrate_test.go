@@ -0,0 +1,109 @@
+package bond_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/db.v3"
+)
+
+type Widget struct {
+	ID        int64      `db:"id,omitempty"`
+	Name      string     `db:"name" bond:"size=64,unique"`
+	Kind      string     `db:"kind,omitempty" bond:"index,default='gear'"`
+	Weight    *float64   `db:"weight"`
+	CreatedAt time.Time  `db:"created_at,omitempty" bond:"default=now()"`
+	DeletedAt *time.Time `db:"deleted_at"`
+}
+
+func (w *Widget) Store(sess bond.Session) bond.Store {
+	return sess.Store("auto_widgets")
+}
+
+type WidgetV2 struct {
+	Widget `db:",inline"`
+
+	Color string `db:"color" bond:"default='red'"`
+	Notes string `db:"notes"`
+}
+
+type BrokenWidget struct {
+	ID    int64  `db:"id,omitempty"`
+	Shape string `db:"shape" bond:"type=no_such_type"`
+}
+
+func (w *BrokenWidget) Store(sess bond.Session) bond.Store {
+	return sess.Store("auto_broken_widgets")
+}
+
+func TestAutoMigrate(t *testing.T) {
+	_, err := DB.Exec(`DROP TABLE IF EXISTS auto_widgets`)
+	assert.NoError(t, err)
+	defer DB.Exec(`DROP TABLE IF EXISTS auto_widgets`)
+
+	var buf bytes.Buffer
+	err = bond.AutoMigrateDryRun(DB, &buf, &Widget{})
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE TABLE "auto_widgets" (
+  "id" BIGSERIAL NOT NULL,
+  "name" VARCHAR(64) NOT NULL,
+  "kind" TEXT NOT NULL DEFAULT 'gear',
+  "weight" DOUBLE PRECISION,
+  "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  "deleted_at" TIMESTAMP WITH TIME ZONE,
+  PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX "auto_widgets_name_key" ON "auto_widgets" ("name");
+CREATE INDEX "auto_widgets_kind_idx" ON "auto_widgets" ("kind");
+`, buf.String())
+
+	// Dry runs don't touch the database.
+	_, err = bond.Describe(DB, "auto_widgets")
+	assert.Error(t, err)
+
+	err = bond.AutoMigrate(DB, &Widget{})
+	assert.NoError(t, err)
+
+	widget := &Widget{Name: "sprocket"}
+	err = DB.Save(widget)
+	assert.NoError(t, err)
+	assert.NotZero(t, widget.ID)
+
+	// Omitted columns take their defaults.
+	var widgetChk Widget
+	err = DB.Store("auto_widgets").Find(db.Cond{"id": widget.ID}).One(&widgetChk)
+	assert.NoError(t, err)
+	assert.Equal(t, "gear", widgetChk.Kind)
+	assert.WithinDuration(t, time.Now(), widgetChk.CreatedAt, time.Minute)
+
+	buf.Reset()
+	err = bond.AutoMigrateDryRun(DB, &buf, &WidgetV2{})
+	assert.NoError(t, err)
+	assert.Equal(t, `ALTER TABLE "auto_widgets" ADD COLUMN "color" TEXT NOT NULL DEFAULT 'red';
+ALTER TABLE "auto_widgets" ADD COLUMN "notes" TEXT;
+`, buf.String())
+
+	err = bond.AutoMigrate(DB, &WidgetV2{})
+	assert.NoError(t, err)
+
+	problems, err := bond.CheckSchema(DB, &WidgetV2{})
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+
+	// Nothing left to migrate.
+	buf.Reset()
+	err = bond.AutoMigrateDryRun(DB, &buf, &WidgetV2{})
+	assert.NoError(t, err)
+	assert.Empty(t, buf.String())
+
+	// Migrations are atomic on PostgreSQL.
+	_, err = DB.Exec(`DROP TABLE auto_widgets`)
+	assert.NoError(t, err)
+	err = bond.AutoMigrate(DB, &Widget{}, &BrokenWidget{})
+	assert.Error(t, err)
+	_, err = bond.Describe(DB, "auto_widgets")
+	assert.Error(t, err)
+}
@@ -54,4 +54,8 @@ type HasAfterDelete interface {
 	AfterDelete(Session) error
 }
 
+type HasAfterFind interface {
+	AfterFind(Session) error
+}
+
 type StoreFunc func(sess Session) Store
@@ -0,0 +1,162 @@
+// Package bondotel traces bond sessions with OpenTelemetry.
+//
+// A Tracer is a bond.QueryObserver that records a span for every store
+// operation, model hook, transaction and query of the sessions it observes:
+//
+//	sess := db.WithObserver(bondotel.New())
+//	err := sess.WithContext(ctx).Save(account)
+//
+// Spans are parented on the context of the session.
+package bondotel
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"upper.io/bond"
+)
+
+const instrumentationName = "upper.io/bond/bondotel"
+
+// Tracer records the spans of observed sessions.
+type Tracer struct {
+	tracer trace.Tracer
+	system string
+}
+
+var (
+	_ bond.QueryObserver = (*Tracer)(nil)
+	_ bond.StoreObserver = (*Tracer)(nil)
+	_ bond.HookObserver  = (*Tracer)(nil)
+	_ bond.TxObserver    = (*Tracer)(nil)
+)
+
+// Option configures a Tracer.
+type Option func(*Tracer)
+
+// WithTracerProvider sets the provider of the tracer, the global provider is
+// used by default.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(t *Tracer) {
+		t.tracer = provider.Tracer(instrumentationName)
+	}
+}
+
+// WithDBSystem sets the db.system attribute of spans, "postgresql" by
+// default.
+func WithDBSystem(system string) Option {
+	return func(t *Tracer) {
+		t.system = system
+	}
+}
+
+// New returns a tracer.
+func New(opts ...Option) *Tracer {
+	t := &Tracer{system: "postgresql"}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.tracer == nil {
+		t.tracer = otel.GetTracerProvider().Tracer(instrumentationName)
+	}
+	return t
+}
+
+// StartStoreOp starts the span of a store operation.
+func (t *Tracer) StartStoreOp(ctx context.Context, e *bond.StoreEvent) (context.Context, func(error)) {
+	ctx, span := t.tracer.Start(ctx, "bond."+e.Op+" "+e.Collection,
+		trace.WithAttributes(t.attributes(e.Collection, e.Op, e.Model)...),
+	)
+	return ctx, endSpan(span)
+}
+
+// StartHook starts the span of a model hook.
+func (t *Tracer) StartHook(ctx context.Context, e *bond.HookEvent) (context.Context, func(error)) {
+	attrs := append(t.attributes(e.Collection, "", e.Model), attribute.String("bond.hook", e.Hook))
+	ctx, span := t.tracer.Start(ctx, "bond.hook "+e.Hook, trace.WithAttributes(attrs...))
+	return ctx, endSpan(span)
+}
+
+// StartTx starts the span of a transaction, its bond.tx.outcome attribute is
+// either "commit" or "rollback".
+func (t *Tracer) StartTx(ctx context.Context) (context.Context, func(error)) {
+	ctx, span := t.tracer.Start(ctx, "bond.tx",
+		trace.WithAttributes(attribute.String("db.system", t.system)),
+	)
+	end := endSpan(span)
+	return ctx, func(err error) {
+		outcome := "commit"
+		if err != nil {
+			outcome = "rollback"
+		}
+		span.SetAttributes(attribute.String("bond.tx.outcome", outcome))
+		end(err)
+	}
+}
+
+// ObserveQuery records the span of a query, the span starts and ends when
+// the query did.
+func (t *Tracer) ObserveQuery(e *bond.QueryEvent) {
+	ctx := e.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	op := operation(e.Query)
+	name := op
+	if e.Collection != "" {
+		name += " " + e.Collection
+	}
+
+	attrs := append(t.attributes(e.Collection, op, e.Model),
+		attribute.String("db.statement", e.Query),
+		attribute.Int64("bond.rows_affected", e.RowsAffected),
+	)
+	_, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(e.Start),
+		trace.WithAttributes(attrs...),
+	)
+	if e.Err != nil {
+		span.RecordError(e.Err)
+		span.SetStatus(codes.Error, e.Err.Error())
+	}
+	span.End(trace.WithTimestamp(e.Start.Add(e.Duration)))
+}
+
+func (t *Tracer) attributes(collection, op, model string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String("db.system", t.system)}
+	if collection != "" {
+		attrs = append(attrs, attribute.String("db.sql.table", collection))
+	}
+	if op != "" {
+		attrs = append(attrs, attribute.String("db.operation", op))
+	}
+	if model != "" {
+		attrs = append(attrs, attribute.String("bond.model", model))
+	}
+	return attrs
+}
+
+func endSpan(span trace.Span) func(error) {
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// operation returns the first keyword of query, e.g. "SELECT".
+func operation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
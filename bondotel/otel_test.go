@@ -0,0 +1,177 @@
+package bondotel_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"upper.io/bond"
+	"upper.io/bond/bondotel"
+	"upper.io/bond/memdb"
+)
+
+type Account struct {
+	ID   int64  `db:"id,omitempty"`
+	Name string `db:"name"`
+}
+
+func (a *Account) Store(sess bond.Session) bond.Store {
+	return sess.Store("accounts")
+}
+
+func (a *Account) Validate() error {
+	if a.Name == "" {
+		return errors.New("missing name")
+	}
+	return nil
+}
+
+func (a *Account) AfterCreate(sess bond.Session) error {
+	return sess.Save(&Log{Message: "created " + a.Name})
+}
+
+type Log struct {
+	ID      int64  `db:"id,omitempty"`
+	Message string `db:"message"`
+}
+
+func (l *Log) Store(sess bond.Session) bond.Store {
+	return sess.Store("logs")
+}
+
+func newTracer() (*bondotel.Tracer, *tracetest.SpanRecorder, *sdktrace.TracerProvider) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return bondotel.New(bondotel.WithTracerProvider(provider)), recorder, provider
+}
+
+func spanNamed(spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	for _, span := range spans {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func hasAttribute(span sdktrace.ReadOnlySpan, kv attribute.KeyValue) bool {
+	for _, attr := range span.Attributes() {
+		if attr == kv {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStoreSpans(t *testing.T) {
+	tracer, recorder, provider := newTracer()
+	sess := memdb.New(memdb.Schema{"accounts": {"id"}, "logs": {"id"}}).WithObserver(tracer)
+
+	ctx, root := provider.Tracer("test").Start(context.Background(), "request")
+	err := sess.WithContext(ctx).Save(&Account{Name: "Pressly"})
+	assert.NoError(t, err)
+	root.End()
+
+	spans := recorder.Ended()
+	save := spanNamed(spans, "bond.save accounts")
+	create := spanNamed(spans, "bond.create accounts")
+	validate := spanNamed(spans, "bond.hook Validate")
+	afterCreate := spanNamed(spans, "bond.hook AfterCreate")
+	createLog := spanNamed(spans, "bond.create logs")
+	if !assert.NotNil(t, save) || !assert.NotNil(t, create) || !assert.NotNil(t, validate) ||
+		!assert.NotNil(t, afterCreate) || !assert.NotNil(t, createLog) {
+		return
+	}
+
+	assert.Equal(t, root.SpanContext().SpanID(), save.Parent().SpanID())
+	assert.Equal(t, save.SpanContext().SpanID(), create.Parent().SpanID())
+	assert.Equal(t, create.SpanContext().SpanID(), validate.Parent().SpanID())
+	assert.Equal(t, create.SpanContext().SpanID(), afterCreate.Parent().SpanID())
+
+	// Saves within hooks are children of the hook.
+	assert.Equal(t, afterCreate.SpanContext().TraceID(), createLog.SpanContext().TraceID())
+	assert.Equal(t, afterCreate.SpanContext().SpanID(), spanNamed(spans, "bond.save logs").Parent().SpanID())
+
+	assert.True(t, hasAttribute(create, attribute.String("db.system", "postgresql")))
+	assert.True(t, hasAttribute(create, attribute.String("db.sql.table", "accounts")))
+	assert.True(t, hasAttribute(create, attribute.String("db.operation", "create")))
+	assert.True(t, hasAttribute(create, attribute.String("bond.model", "Account")))
+
+	// Failed operations are marked as errors.
+	err = sess.Save(&Account{})
+	assert.Error(t, err)
+	failed := recorder.Ended()[len(recorder.Ended())-1]
+	assert.Equal(t, "bond.save accounts", failed.Name())
+	assert.Equal(t, codes.Error, failed.Status().Code)
+}
+
+func TestTxSpans(t *testing.T) {
+	tracer, recorder, _ := newTracer()
+	sess := memdb.New(memdb.Schema{"accounts": {"id"}, "logs": {"id"}}).WithObserver(tracer)
+
+	err := sess.SessionTx(nil, func(tx bond.Session) error {
+		return tx.Save(&Log{Message: "committed"})
+	})
+	assert.NoError(t, err)
+
+	err = sess.SessionTx(nil, func(tx bond.Session) error {
+		return errors.New("rolling back")
+	})
+	assert.Error(t, err)
+
+	var txs []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "bond.tx" {
+			txs = append(txs, span)
+		}
+	}
+	if assert.Len(t, txs, 2) {
+		assert.True(t, hasAttribute(txs[0], attribute.String("bond.tx.outcome", "commit")))
+		assert.True(t, hasAttribute(txs[1], attribute.String("bond.tx.outcome", "rollback")))
+		assert.Equal(t, codes.Error, txs[1].Status().Code)
+
+		save := spanNamed(recorder.Ended(), "bond.save logs")
+		assert.Equal(t, txs[0].SpanContext().SpanID(), save.Parent().SpanID())
+	}
+}
+
+func TestQuerySpans(t *testing.T) {
+	tracer, recorder, provider := newTracer()
+
+	ctx, root := provider.Tracer("test").Start(context.Background(), "request")
+	start := time.Now()
+	tracer.ObserveQuery(&bond.QueryEvent{
+		Query:      `SELECT * FROM "accounts" WHERE "id" = $1`,
+		Start:      start,
+		Duration:   5 * time.Millisecond,
+		Collection: "accounts",
+		Model:      "Account",
+		Context:    ctx,
+	})
+	tracer.ObserveQuery(&bond.QueryEvent{
+		Query: "DELETE FROM logs",
+		Start: start,
+		Err:   errors.New("permission denied"),
+	})
+	root.End()
+
+	query := spanNamed(recorder.Ended(), "SELECT accounts")
+	if assert.NotNil(t, query) {
+		assert.Equal(t, root.SpanContext().SpanID(), query.Parent().SpanID())
+		assert.Equal(t, 5*time.Millisecond, query.EndTime().Sub(query.StartTime()))
+		assert.True(t, hasAttribute(query, attribute.String("db.operation", "SELECT")))
+		assert.True(t, hasAttribute(query, attribute.String("db.sql.table", "accounts")))
+	}
+
+	failed := spanNamed(recorder.Ended(), "DELETE")
+	if assert.NotNil(t, failed) {
+		assert.Equal(t, codes.Error, failed.Status().Code)
+		assert.False(t, failed.Parent().IsValid())
+	}
+}
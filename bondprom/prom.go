@@ -0,0 +1,230 @@
+// Package bondprom exposes Prometheus metrics of bond sessions.
+//
+// A Collector is a bond.QueryObserver, sessions observed by it report their
+// store operations, transactions, hooks and queries:
+//
+//	collector := bondprom.NewCollector()
+//	prometheus.MustRegister(collector)
+//	collector.WatchSession("main", sess)
+//	sess = sess.WithObserver(collector)
+package bondprom
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"upper.io/bond"
+)
+
+const namespace = "bond"
+
+// Collector collects the metrics of observed sessions and the connection
+// pool stats of watched databases.
+type Collector struct {
+	storeOps      *prometheus.CounterVec
+	storeDuration *prometheus.HistogramVec
+	txDuration    *prometheus.HistogramVec
+	txRollbacks   prometheus.Counter
+	hookFailures  *prometheus.CounterVec
+	queryDuration *prometheus.HistogramVec
+
+	dbs map[string]*sql.DB
+	mu  sync.RWMutex
+}
+
+var (
+	_ bond.QueryObserver   = (*Collector)(nil)
+	_ bond.StoreObserver   = (*Collector)(nil)
+	_ bond.HookObserver    = (*Collector)(nil)
+	_ bond.TxObserver      = (*Collector)(nil)
+	_ prometheus.Collector = (*Collector)(nil)
+)
+
+// NewCollector returns a collector, register it on a prometheus.Registerer
+// to expose its metrics.
+func NewCollector() *Collector {
+	return &Collector{
+		storeOps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "store_operations_total",
+			Help:      "Store operations by collection, operation and outcome.",
+		}, []string{"collection", "op", "outcome"}),
+		storeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "store_operation_duration_seconds",
+			Help:      "Duration of store operations, hooks included.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"collection", "op"}),
+		txDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "tx_duration_seconds",
+			Help:      "Duration of transactions by outcome.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"outcome"}),
+		txRollbacks: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tx_rollbacks_total",
+			Help:      "Transactions rolled back.",
+		}),
+		hookFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "hook_failures_total",
+			Help:      "Model hooks that returned an error, by collection and hook.",
+		}, []string{"collection", "hook"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_duration_seconds",
+			Help:      "Duration of queries by collection, operation and outcome.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"collection", "operation", "outcome"}),
+		dbs: make(map[string]*sql.DB),
+	}
+}
+
+// Register registers the collector on reg.
+func (c *Collector) Register(reg prometheus.Registerer) error {
+	return reg.Register(c)
+}
+
+// WatchDB exposes the connection pool stats of db, labeled with name.
+func (c *Collector) WatchDB(name string, db *sql.DB) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dbs[name] = db
+}
+
+// WatchSession exposes the connection pool stats of the database behind
+// sess.Driver(), labeled with name. Sessions bound to a transaction can't be
+// watched.
+func (c *Collector) WatchSession(name string, sess bond.Session) error {
+	db, ok := sess.Driver().(*sql.DB)
+	if !ok {
+		return fmt.Errorf("bondprom: can't watch the pool of a %T", sess.Driver())
+	}
+	c.WatchDB(name, db)
+	return nil
+}
+
+// StartStoreOp implements bond.StoreObserver.
+func (c *Collector) StartStoreOp(ctx context.Context, e *bond.StoreEvent) (context.Context, func(error)) {
+	start := time.Now()
+	return ctx, func(err error) {
+		c.storeOps.WithLabelValues(e.Collection, e.Op, outcome(err)).Inc()
+		c.storeDuration.WithLabelValues(e.Collection, e.Op).Observe(time.Since(start).Seconds())
+	}
+}
+
+// StartHook implements bond.HookObserver.
+func (c *Collector) StartHook(ctx context.Context, e *bond.HookEvent) (context.Context, func(error)) {
+	return ctx, func(err error) {
+		if err != nil {
+			c.hookFailures.WithLabelValues(e.Collection, e.Hook).Inc()
+		}
+	}
+}
+
+// StartTx implements bond.TxObserver.
+func (c *Collector) StartTx(ctx context.Context) (context.Context, func(error)) {
+	start := time.Now()
+	return ctx, func(err error) {
+		result := "commit"
+		if err != nil {
+			result = "rollback"
+			c.txRollbacks.Inc()
+		}
+		c.txDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveQuery implements bond.QueryObserver.
+func (c *Collector) ObserveQuery(e *bond.QueryEvent) {
+	op := ""
+	if fields := strings.Fields(e.Query); len(fields) > 0 {
+		op = strings.ToUpper(fields[0])
+	}
+	c.queryDuration.WithLabelValues(e.Collection, op, outcome(e.Err)).Observe(e.Duration.Seconds())
+}
+
+var (
+	openConnsDesc = prometheus.NewDesc(namespace+"_db_open_connections",
+		"Established connections, in use or idle.", []string{"db"}, nil)
+	inUseDesc = prometheus.NewDesc(namespace+"_db_in_use_connections",
+		"Connections in use.", []string{"db"}, nil)
+	idleDesc = prometheus.NewDesc(namespace+"_db_idle_connections",
+		"Idle connections.", []string{"db"}, nil)
+	maxOpenDesc = prometheus.NewDesc(namespace+"_db_max_open_connections",
+		"Maximum number of open connections, 0 means unlimited.", []string{"db"}, nil)
+	waitCountDesc = prometheus.NewDesc(namespace+"_db_wait_count_total",
+		"Connections waited for.", []string{"db"}, nil)
+	waitDurationDesc = prometheus.NewDesc(namespace+"_db_wait_duration_seconds_total",
+		"Time spent waiting for connections.", []string{"db"}, nil)
+	maxIdleClosedDesc = prometheus.NewDesc(namespace+"_db_max_idle_closed_total",
+		"Connections closed because of SetMaxIdleConns.", []string{"db"}, nil)
+	maxIdleTimeClosedDesc = prometheus.NewDesc(namespace+"_db_max_idle_time_closed_total",
+		"Connections closed because of SetConnMaxIdleTime.", []string{"db"}, nil)
+	maxLifetimeClosedDesc = prometheus.NewDesc(namespace+"_db_max_lifetime_closed_total",
+		"Connections closed because of SetConnMaxLifetime.", []string{"db"}, nil)
+)
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.storeOps.Describe(ch)
+	c.storeDuration.Describe(ch)
+	c.txDuration.Describe(ch)
+	c.txRollbacks.Describe(ch)
+	c.hookFailures.Describe(ch)
+	c.queryDuration.Describe(ch)
+
+	ch <- openConnsDesc
+	ch <- inUseDesc
+	ch <- idleDesc
+	ch <- maxOpenDesc
+	ch <- waitCountDesc
+	ch <- waitDurationDesc
+	ch <- maxIdleClosedDesc
+	ch <- maxIdleTimeClosedDesc
+	ch <- maxLifetimeClosedDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.storeOps.Collect(ch)
+	c.storeDuration.Collect(ch)
+	c.txDuration.Collect(ch)
+	c.txRollbacks.Collect(ch)
+	c.hookFailures.Collect(ch)
+	c.queryDuration.Collect(ch)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for name, db := range c.dbs {
+		stats := db.Stats()
+		gauge := func(desc *prometheus.Desc, value float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, name)
+		}
+		counter := func(desc *prometheus.Desc, value float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, name)
+		}
+		gauge(openConnsDesc, float64(stats.OpenConnections))
+		gauge(inUseDesc, float64(stats.InUse))
+		gauge(idleDesc, float64(stats.Idle))
+		gauge(maxOpenDesc, float64(stats.MaxOpenConnections))
+		counter(waitCountDesc, float64(stats.WaitCount))
+		counter(waitDurationDesc, stats.WaitDuration.Seconds())
+		counter(maxIdleClosedDesc, float64(stats.MaxIdleClosed))
+		counter(maxIdleTimeClosedDesc, float64(stats.MaxIdleTimeClosed))
+		counter(maxLifetimeClosedDesc, float64(stats.MaxLifetimeClosed))
+	}
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
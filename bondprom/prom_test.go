@@ -0,0 +1,101 @@
+package bondprom_test
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/bond/bondprom"
+	"upper.io/bond/memdb"
+)
+
+type Account struct {
+	ID   int64  `db:"id,omitempty"`
+	Name string `db:"name"`
+}
+
+func (a *Account) Store(sess bond.Session) bond.Store {
+	return sess.Store("accounts")
+}
+
+func (a *Account) Validate() error {
+	if a.Name == "" {
+		return errors.New("missing name")
+	}
+	return nil
+}
+
+func TestCollector(t *testing.T) {
+	collector := bondprom.NewCollector()
+	reg := prometheus.NewPedanticRegistry()
+	assert.NoError(t, collector.Register(reg))
+
+	sess := memdb.New(memdb.Schema{"accounts": {"id"}}).WithObserver(collector)
+
+	assert.NoError(t, sess.Save(&Account{Name: "Pressly"}))
+	assert.Error(t, sess.Save(&Account{}))
+
+	err := sess.SessionTx(nil, func(tx bond.Session) error {
+		return tx.Save(&Account{Name: "Committed"})
+	})
+	assert.NoError(t, err)
+	err = sess.SessionTx(nil, func(tx bond.Session) error {
+		return errors.New("rolling back")
+	})
+	assert.Error(t, err)
+
+	expected := `
+# HELP bond_store_operations_total Store operations by collection, operation and outcome.
+# TYPE bond_store_operations_total counter
+bond_store_operations_total{collection="accounts",op="create",outcome="error"} 1
+bond_store_operations_total{collection="accounts",op="create",outcome="success"} 2
+bond_store_operations_total{collection="accounts",op="save",outcome="error"} 1
+bond_store_operations_total{collection="accounts",op="save",outcome="success"} 2
+# HELP bond_hook_failures_total Model hooks that returned an error, by collection and hook.
+# TYPE bond_hook_failures_total counter
+bond_hook_failures_total{collection="accounts",hook="Validate"} 1
+# HELP bond_tx_rollbacks_total Transactions rolled back.
+# TYPE bond_tx_rollbacks_total counter
+bond_tx_rollbacks_total 1
+`
+	err = testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"bond_store_operations_total", "bond_hook_failures_total", "bond_tx_rollbacks_total")
+	assert.NoError(t, err)
+
+	count, err := testutil.GatherAndCount(reg, "bond_tx_duration_seconds")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestWatchDB(t *testing.T) {
+	db, err := sql.Open("postgres", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(7)
+
+	collector := bondprom.NewCollector()
+	collector.WatchDB("main", db)
+
+	reg := prometheus.NewPedanticRegistry()
+	assert.NoError(t, collector.Register(reg))
+
+	expected := `
+# HELP bond_db_max_open_connections Maximum number of open connections, 0 means unlimited.
+# TYPE bond_db_max_open_connections gauge
+bond_db_max_open_connections{db="main"} 7
+# HELP bond_db_open_connections Established connections, in use or idle.
+# TYPE bond_db_open_connections gauge
+bond_db_open_connections{db="main"} 0
+`
+	err = testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"bond_db_max_open_connections", "bond_db_open_connections")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,256 @@
+package bondtest
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"upper.io/bond"
+)
+
+// Factories builds models from default attributes registered per model type:
+//
+//	factories := bondtest.NewFactories()
+//	factories.Define(&Account{}, func(b *bondtest.Builder) {
+//		b.Set("name", b.Sequence("Account %d"))
+//	}).Trait("disabled", func(b *bondtest.Builder) {
+//		b.Set("disabled", true)
+//	})
+//	factories.Define(&User{}, func(b *bondtest.Builder) {
+//		b.Set("username", b.Sequence("user%d"))
+//		b.Belongs("account_id", &Account{})
+//	})
+//
+//	user := &User{Username: "peter"}
+//	err := factories.Create(sess, user)
+//
+// Non-zero fields of the model given to Build or Create are kept, defaults
+// and traits only set the remaining columns. Traits override defaults.
+type Factories struct {
+	factories map[reflect.Type]*Factory
+	mu        sync.RWMutex
+}
+
+// NewFactories returns an empty set of factories.
+func NewFactories() *Factories {
+	return &Factories{factories: make(map[reflect.Type]*Factory)}
+}
+
+// Factory builds models of a single type.
+type Factory struct {
+	fs       *Factories
+	defaults func(b *Builder)
+	traits   map[string]func(b *Builder)
+	seq      int64
+	mu       sync.RWMutex
+}
+
+// Define registers the default attributes for the type of model, defining a
+// type again replaces its factory.
+func (fs *Factories) Define(model bond.Model, defaults func(b *Builder)) *Factory {
+	f := &Factory{
+		fs:       fs,
+		defaults: defaults,
+		traits:   make(map[string]func(b *Builder)),
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.factories[modelType(model)] = f
+	return f
+}
+
+// Trait registers a named set of attributes, traits are applied after the
+// defaults in the order they're given to Build or Create.
+func (f *Factory) Trait(name string, fn func(b *Builder)) *Factory {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.traits[name] = fn
+	return f
+}
+
+// Build sets the columns of item that are zero from the defaults of its type
+// and the given traits. Build does not save item, but models that item
+// belongs to are created.
+func (fs *Factories) Build(sess bond.Session, item bond.Model, traits ...string) error {
+	v := reflect.ValueOf(item)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return bond.ErrExpectingPointerToStruct
+	}
+
+	fs.mu.RLock()
+	f, ok := fs.factories[v.Elem().Type()]
+	fs.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("bondtest: no factory for %v", v.Elem().Type())
+	}
+
+	b := &Builder{
+		Session: sess,
+		Seq:     atomic.AddInt64(&f.seq, 1),
+		fs:      fs,
+		item:    v.Elem(),
+		locked:  nonZeroColumns(v.Elem()),
+	}
+
+	f.mu.RLock()
+	fns := make([]func(b *Builder), 0, len(traits)+1)
+	if f.defaults != nil {
+		fns = append(fns, f.defaults)
+	}
+	for _, name := range traits {
+		fn, ok := f.traits[name]
+		if !ok {
+			f.mu.RUnlock()
+			return fmt.Errorf("bondtest: unknown trait %q for %v", name, v.Elem().Type())
+		}
+		fns = append(fns, fn)
+	}
+	f.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(b)
+		if b.err != nil {
+			return b.err
+		}
+	}
+	return nil
+}
+
+// Create builds item and saves it with Session.Save, so model hooks run as
+// usual.
+func (fs *Factories) Create(sess bond.Session, item bond.Model, traits ...string) error {
+	if err := fs.Build(sess, item, traits...); err != nil {
+		return err
+	}
+	return sess.Save(item)
+}
+
+// CreateN creates n models with the same type as item, the non-zero fields of
+// item are copied to every model.
+func (fs *Factories) CreateN(sess bond.Session, n int, item bond.Model, traits ...string) ([]bond.Model, error) {
+	v := reflect.ValueOf(item)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, bond.ErrExpectingPointerToStruct
+	}
+
+	models := make([]bond.Model, 0, n)
+	for i := 0; i < n; i++ {
+		copied := reflect.New(v.Elem().Type())
+		copied.Elem().Set(v.Elem())
+
+		model := copied.Interface().(bond.Model)
+		if err := fs.Create(sess, model, traits...); err != nil {
+			return models, err
+		}
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+// Builder sets the attributes of a model being built.
+type Builder struct {
+	// Session is the session the model is built with.
+	Session bond.Session
+
+	// Seq is the sequence number of the model, it's unique per model type and
+	// starts at 1.
+	Seq int64
+
+	fs     *Factories
+	item   reflect.Value
+	locked map[string]bool // columns given by the caller
+	err    error
+}
+
+// Set sets column to value, unless the column was given by the caller. Values
+// set by traits replace the values set by defaults.
+func (b *Builder) Set(column string, value interface{}) {
+	if b.err != nil || b.locked[column] {
+		return
+	}
+
+	field := mapper.FieldByName(b.item, column)
+	if !field.IsValid() {
+		b.err = fmt.Errorf("bondtest: unknown column %q for %v", column, b.item.Type())
+		return
+	}
+	if err := setValue(field, value); err != nil {
+		b.err = fmt.Errorf("bondtest: column %q: %v", column, err)
+	}
+}
+
+// Sequence formats the sequence number of the model with format, which must
+// have a single verb, e.g. "user%d@example.com".
+func (b *Builder) Sequence(format string) string {
+	return fmt.Sprintf(format, b.Seq)
+}
+
+// Belongs creates related with its factory and sets column to the primary key
+// of related. Nothing is created when the column was given by the caller.
+func (b *Builder) Belongs(column string, related bond.Model, traits ...string) {
+	if b.err != nil || b.locked[column] {
+		return
+	}
+
+	pKeys, err := primaryKeys(b.Session, related)
+	if err != nil {
+		b.err = err
+		return
+	}
+	if len(pKeys) != 1 {
+		b.err = fmt.Errorf("bondtest: %T must have a single primary key", related)
+		return
+	}
+
+	if err := b.fs.Create(b.Session, related, traits...); err != nil {
+		b.err = err
+		return
+	}
+	id := mapper.FieldByName(reflect.Indirect(reflect.ValueOf(related)), pKeys[0])
+	if !id.IsValid() {
+		b.err = fmt.Errorf("bondtest: %T has no %s column", related, pKeys[0])
+		return
+	}
+	b.Set(column, id.Interface())
+}
+
+type hasPrimaryKeys interface {
+	PrimaryKeys() []string
+}
+
+// primaryKeys returns the primary keys of the model's store, which are
+// introspected when the store doesn't know them.
+func primaryKeys(sess bond.Session, model bond.Model) ([]string, error) {
+	st := model.Store(sess)
+	if pk, ok := st.(hasPrimaryKeys); ok {
+		if pKeys := pk.PrimaryKeys(); len(pKeys) > 0 {
+			return pKeys, nil
+		}
+	}
+	tables, err := bond.Describe(sess, st.Name())
+	if err != nil {
+		return nil, err
+	}
+	return tables[0].PrimaryKey, nil
+}
+
+// nonZeroColumns returns the columns of v whose fields are not zero.
+func nonZeroColumns(v reflect.Value) map[string]bool {
+	set := make(map[string]bool)
+	for column, field := range mapper.FieldMap(v) {
+		if !field.IsZero() {
+			set[column] = true
+		}
+	}
+	return set
+}
+
+func modelType(model bond.Model) reflect.Type {
+	t := reflect.TypeOf(model)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
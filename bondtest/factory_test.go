@@ -0,0 +1,93 @@
+package bondtest_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond/bondtest"
+	"upper.io/bond/memdb"
+	"upper.io/db.v3"
+)
+
+func newFactories() *bondtest.Factories {
+	factories := bondtest.NewFactories()
+	factories.Define(&Account{}, func(b *bondtest.Builder) {
+		b.Set("name", b.Sequence("Account %d"))
+	}).Trait("disabled", func(b *bondtest.Builder) {
+		b.Set("disabled", true)
+	}).Trait("acme", func(b *bondtest.Builder) {
+		b.Set("name", "Acme")
+	})
+	factories.Define(&User{}, func(b *bondtest.Builder) {
+		b.Set("username", b.Sequence("user%d"))
+		b.Belongs("account_id", &Account{})
+	})
+	return factories
+}
+
+func TestFactories(t *testing.T) {
+	sess := bondtest.SQLite(t, "testdata/schema.sql")
+	factories := newFactories()
+
+	acct := &Account{}
+	err := factories.Create(sess, acct, "disabled")
+	assert.NoError(t, err)
+	assert.NotZero(t, acct.ID)
+	assert.Equal(t, "Account 1", acct.Name)
+	assert.True(t, acct.Disabled)
+
+	// Non-zero fields are kept.
+	user := &User{Username: "peter"}
+	err = factories.Create(sess, user)
+	assert.NoError(t, err)
+	assert.Equal(t, "peter", user.Username)
+	assert.NotZero(t, user.AccountID)
+
+	// Relations are created only when missing.
+	users, err := factories.CreateN(sess, 3, &User{AccountID: acct.ID})
+	assert.NoError(t, err)
+	if assert.Len(t, users, 3) {
+		assert.Equal(t, "user2", users[0].(*User).Username)
+		assert.Equal(t, "user4", users[2].(*User).Username)
+	}
+
+	count, err := sess.Store("accounts").Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), count)
+
+	// Traits override defaults, but not the fields given by the caller.
+	acme := &Account{}
+	err = factories.Build(sess, acme, "acme")
+	assert.NoError(t, err)
+	assert.Equal(t, "Acme", acme.Name)
+
+	named := &Account{Name: "Named"}
+	err = factories.Build(sess, named, "acme")
+	assert.NoError(t, err)
+	assert.Equal(t, "Named", named.Name)
+
+	count, err = sess.Store("users").Find(db.Cond{"account_id": acct.ID}).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), count)
+
+	err = factories.Create(sess, &Account{}, "unknown")
+	assert.Error(t, err)
+}
+
+func TestFactoriesMemDB(t *testing.T) {
+	// Relations don't need introspection, which memdb doesn't support.
+	sess := memdb.New(memdb.Schema{
+		"accounts": {"id"},
+		"users":    {"id"},
+	})
+
+	user := &User{}
+	err := newFactories().Create(sess, user)
+	assert.NoError(t, err)
+	assert.NotZero(t, user.AccountID)
+
+	var acct Account
+	err = sess.Store("accounts").Find(db.Cond{"id": user.AccountID}).One(&acct)
+	assert.NoError(t, err)
+	assert.Equal(t, "Account 1", acct.Name)
+}
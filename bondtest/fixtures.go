@@ -0,0 +1,243 @@
+package bondtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"upper.io/bond"
+	"upper.io/db.v3/lib/reflectx"
+)
+
+var mapper = reflectx.NewMapper("db")
+
+// Fixtures loads fixture files into models. A fixture file maps fixture names
+// to lists of records, records are maps of column names to values:
+//
+//	accounts:
+//	  - name: Pressly
+//	    disabled: false
+//	users:
+//	  - username: peter
+//	    account_id: 1
+//
+// Fixture names are bound to models with Register. Fixtures are loaded in the
+// order they appear in the file and each record is saved with Session.Save,
+// so model hooks run as usual.
+type Fixtures struct {
+	models map[string]reflect.Type
+	mu     sync.RWMutex
+}
+
+// NewFixtures returns an empty set of fixtures.
+func NewFixtures() *Fixtures {
+	return &Fixtures{models: make(map[string]reflect.Type)}
+}
+
+// Register binds the given fixture name to the type of model.
+func (f *Fixtures) Register(name string, model bond.Model) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.models[name] = modelType(model)
+}
+
+type fixture struct {
+	name    string
+	records []map[string]interface{}
+}
+
+// Load reads a YAML (.yml or .yaml) or JSON (.json) fixture file and saves its
+// records. It returns the saved models by fixture name.
+func (f *Fixtures) Load(sess bond.Session, file string) (map[string][]bond.Model, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixtures []fixture
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yml", ".yaml":
+		fixtures, err = parseYAML(data)
+	case ".json":
+		fixtures, err = parseJSON(data)
+	default:
+		return nil, fmt.Errorf("bondtest: unknown fixture format %q", filepath.Ext(file))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bondtest: parsing %s: %v", file, err)
+	}
+
+	return f.save(sess, fixtures)
+}
+
+func (f *Fixtures) save(sess bond.Session, fixtures []fixture) (map[string][]bond.Model, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	loaded := make(map[string][]bond.Model)
+	for _, fx := range fixtures {
+		t, ok := f.models[fx.name]
+		if !ok {
+			return nil, fmt.Errorf("bondtest: unregistered fixture %q", fx.name)
+		}
+
+		for i, record := range fx.records {
+			item := reflect.New(t)
+			if err := setFields(item, record); err != nil {
+				return nil, fmt.Errorf("bondtest: %s[%d]: %v", fx.name, i, err)
+			}
+
+			model, ok := item.Interface().(bond.Model)
+			if !ok {
+				return nil, fmt.Errorf("bondtest: %v is not a bond.Model", item.Type())
+			}
+			if err := sess.Save(model); err != nil {
+				return nil, fmt.Errorf("bondtest: %s[%d]: %v", fx.name, i, err)
+			}
+			loaded[fx.name] = append(loaded[fx.name], model)
+		}
+	}
+	return loaded, nil
+}
+
+func parseYAML(data []byte) ([]fixture, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	fixtures := make([]fixture, 0, len(doc))
+	for _, entry := range doc {
+		list, ok := entry.Value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expecting a list of records for %v", entry.Key)
+		}
+		fx := fixture{name: fmt.Sprintf("%v", entry.Key)}
+		for _, item := range list {
+			slice, ok := item.(yaml.MapSlice)
+			if !ok {
+				return nil, fmt.Errorf("expecting a map for every record of %v", entry.Key)
+			}
+			record := make(map[string]interface{}, len(slice))
+			for _, field := range slice {
+				record[fmt.Sprintf("%v", field.Key)] = field.Value
+			}
+			fx.records = append(fx.records, record)
+		}
+		fixtures = append(fixtures, fx)
+	}
+	return fixtures, nil
+}
+
+func parseJSON(data []byte) ([]fixture, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	// Fixtures are read one by one to keep the order of the file.
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("expecting an object")
+	}
+
+	var fixtures []fixture
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		fx := fixture{name: fmt.Sprintf("%v", tok)}
+		if err := dec.Decode(&fx.records); err != nil {
+			return nil, err
+		}
+		fixtures = append(fixtures, fx)
+	}
+	return fixtures, nil
+}
+
+// setFields sets the fields of the struct item points to from a record of
+// column names and values.
+func setFields(item reflect.Value, record map[string]interface{}) error {
+	v := reflect.Indirect(item)
+	for column, value := range record {
+		field := mapper.FieldByName(v, column)
+		if !field.IsValid() {
+			return fmt.Errorf("unknown column %q", column)
+		}
+		if err := setValue(field, value); err != nil {
+			return fmt.Errorf("column %q: %v", column, err)
+		}
+	}
+	return nil
+}
+
+func setValue(field reflect.Value, value interface{}) error {
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	if field.Kind() == reflect.Ptr {
+		elem := reflect.New(field.Type().Elem())
+		if err := setValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+
+	if n, ok := value.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			value = i
+		} else if f, err := n.Float64(); err == nil {
+			value = f
+		}
+	}
+
+	if _, ok := field.Interface().(time.Time); ok {
+		if t, ok := value.(time.Time); ok {
+			field.Set(reflect.ValueOf(t))
+			return nil
+		}
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expecting a RFC3339 time, got %v", value)
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Type().AssignableTo(field.Type()) {
+		field.Set(v)
+		return nil
+	}
+	if isNumber(v.Kind()) && isNumber(field.Kind()) {
+		field.Set(v.Convert(field.Type()))
+		return nil
+	}
+	if v.Kind() == field.Kind() && v.Type().ConvertibleTo(field.Type()) {
+		field.Set(v.Convert(field.Type()))
+		return nil
+	}
+	return fmt.Errorf("cannot use %T as %v", value, field.Type())
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+// Package bondtest provides helpers for testing code that uses bond.
+package bondtest
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+
+	"upper.io/bond"
+	"upper.io/db.v3/sqlite"
+)
+
+var memoryDatabases uint64
+
+// OpenSQLite opens the SQLite database at path and applies the given schema
+// files in order. Use ":memory:" to open a new in-memory database, the
+// database lives until the session is closed.
+func OpenSQLite(path string, schemaFiles ...string) (bond.Session, error) {
+	dsn := path
+	if path == ":memory:" {
+		// Every connection to ":memory:" opens a different database, a named
+		// database with a shared cache is seen by all connections of the pool.
+		n := atomic.AddUint64(&memoryDatabases, 1)
+		dsn = fmt.Sprintf("file:bondtest-%d?mode=memory&cache=shared", n)
+	}
+
+	sqlDB, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applySchema(sqlDB, schemaFiles...); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	conn, err := sqlite.New(sqlDB)
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return bond.New(conn), nil
+}
+
+// SQLite returns a session on a new in-memory SQLite database with the given
+// schema files applied, each test gets its own database. The database is
+// dropped when the test finishes.
+func SQLite(t testing.TB, schemaFiles ...string) bond.Session {
+	t.Helper()
+
+	sess, err := OpenSQLite(":memory:", schemaFiles...)
+	if err != nil {
+		t.Fatalf("bondtest: %v", err)
+	}
+	t.Cleanup(func() {
+		sess.Close()
+	})
+	return sess
+}
+
+func applySchema(sqlDB *sql.DB, schemaFiles ...string) error {
+	for _, file := range schemaFiles {
+		schema, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if _, err := sqlDB.Exec(string(schema)); err != nil {
+			return fmt.Errorf("bondtest: applying %s: %v", file, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package bondtest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/bond/bondtest"
+	"upper.io/db.v3"
+)
+
+type Account struct {
+	ID        int64     `db:"id,omitempty"`
+	Name      string    `db:"name"`
+	Disabled  bool      `db:"disabled"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func (a *Account) Store(sess bond.Session) bond.Store {
+	return sess.Store("accounts")
+}
+
+type User struct {
+	ID        int64  `db:"id,omitempty"`
+	AccountID int64  `db:"account_id"`
+	Username  string `db:"username"`
+}
+
+func (u *User) Store(sess bond.Session) bond.Store {
+	return sess.Store("users")
+}
+
+func newFixtures() *bondtest.Fixtures {
+	fixtures := bondtest.NewFixtures()
+	fixtures.Register("accounts", &Account{})
+	fixtures.Register("users", &User{})
+	return fixtures
+}
+
+func TestSQLite(t *testing.T) {
+	sess := bondtest.SQLite(t, "testdata/schema.sql")
+
+	acct := &Account{Name: "Pressly"}
+	err := sess.Save(acct)
+	assert.NoError(t, err)
+	assert.NotZero(t, acct.ID)
+
+	// Every test gets a fresh database.
+	other := bondtest.SQLite(t, "testdata/schema.sql")
+	count, err := other.Store("accounts").Find().Count()
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestLoadYAML(t *testing.T) {
+	sess := bondtest.SQLite(t, "testdata/schema.sql")
+
+	loaded, err := newFixtures().Load(sess, "testdata/fixtures.yml")
+	assert.NoError(t, err)
+	assert.Len(t, loaded["accounts"], 2)
+	assert.Len(t, loaded["users"], 2)
+
+	var acct Account
+	err = sess.Store("accounts").Find(db.Cond{"name": "Pressly"}).One(&acct)
+	assert.NoError(t, err)
+	assert.Equal(t, 2018, acct.CreatedAt.Year())
+
+	count, err := sess.Store("users").Find(db.Cond{"account_id": acct.ID}).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), count)
+}
+
+func TestLoadJSON(t *testing.T) {
+	sess := bondtest.SQLite(t, "testdata/schema.sql")
+
+	loaded, err := newFixtures().Load(sess, "testdata/fixtures.json")
+	assert.NoError(t, err)
+	assert.Len(t, loaded["accounts"], 1)
+
+	user := loaded["users"][0].(*User)
+	assert.Equal(t, "peter", user.Username)
+	assert.NotZero(t, user.ID)
+}
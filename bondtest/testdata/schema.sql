@@ -0,0 +1,12 @@
+CREATE TABLE accounts (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name VARCHAR(256),
+  disabled BOOLEAN,
+  created_at DATETIME
+);
+
+CREATE TABLE users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  account_id INTEGER,
+  username VARCHAR(256) UNIQUE
+);
@@ -0,0 +1,45 @@
+package bondtest
+
+import (
+	"testing"
+
+	"upper.io/bond"
+)
+
+// Tx returns a session bound to a new transaction of sess, the transaction is
+// rolled back when the test finishes so nothing the test writes is ever seen
+// by other tests. Nested transactions within the test, either SessionTx or
+// NewSessionTx, are savepoints of the test's transaction.
+//
+// The returned session is itself bound to a savepoint, so TxCommit only
+// releases it and TxRollback rolls back to it: the test's transaction is
+// never committed.
+//
+// Tests using Tx don't need to clean up their tables and can run in parallel:
+//
+//	func TestAccounts(t *testing.T) {
+//		t.Parallel()
+//		sess := bondtest.Tx(t, DB)
+//		...
+//	}
+func Tx(t testing.TB, sess bond.Session) bond.Session {
+	t.Helper()
+
+	tx, err := sess.NewSessionTx(nil)
+	if err != nil {
+		t.Fatalf("bondtest: %v", err)
+	}
+	t.Cleanup(func() {
+		tx.TxRollback()
+	})
+
+	nested, err := bond.WithSavepoints(tx)
+	if err != nil {
+		t.Fatalf("bondtest: %v", err)
+	}
+	sp, err := nested.NewSessionTx(nil)
+	if err != nil {
+		t.Fatalf("bondtest: %v", err)
+	}
+	return sp
+}
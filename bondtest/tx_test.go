@@ -0,0 +1,57 @@
+package bondtest_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/bond/bondtest"
+	"upper.io/db.v3"
+)
+
+func TestTx(t *testing.T) {
+	sess := bondtest.SQLite(t, "testdata/schema.sql")
+
+	t.Run("isolated", func(t *testing.T) {
+		tx := bondtest.Tx(t, sess)
+
+		err := tx.Save(&Account{Name: "Pressly"})
+		assert.NoError(t, err)
+
+		err = tx.SessionTx(nil, func(sp bond.Session) error {
+			if err := sp.Save(&Account{Name: "Rolled back"}); err != nil {
+				return err
+			}
+			return errors.New("rolling back")
+		})
+		assert.Error(t, err)
+
+		err = tx.SessionTx(nil, func(sp bond.Session) error {
+			return sp.Save(&Account{Name: "Released"})
+		})
+		assert.NoError(t, err)
+
+		sp, err := tx.NewSessionTx(nil)
+		assert.NoError(t, err)
+		assert.NoError(t, sp.Save(&Account{Name: "Pending"}))
+		assert.NoError(t, sp.TxRollback())
+
+		var names []string
+		var accts []Account
+		err = tx.Store("accounts").Find().OrderBy("id").All(&accts)
+		assert.NoError(t, err)
+		for _, acct := range accts {
+			names = append(names, acct.Name)
+		}
+		assert.Equal(t, []string{"Pressly", "Released"}, names)
+
+		// Committing the test's session doesn't commit its transaction.
+		assert.NoError(t, tx.TxCommit())
+	})
+
+	// Everything written by the test was rolled back.
+	count, err := sess.Store("accounts").Find(db.Cond{}).Count()
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,348 @@
+package bond
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"upper.io/db.v3"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+// Cache stores query results as opaque values, see Session.WithCache.
+// Implementations must be safe for concurrent use, values may be evicted at
+// any time.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+}
+
+// LRUCache is an in-process Cache that keeps a bounded number of values and
+// evicts the least recently used ones.
+type LRUCache struct {
+	size  int
+	items map[string]*list.Element
+	order *list.List
+	mu    sync.Mutex
+}
+
+type lruEntry struct {
+	key   string
+	value []byte
+}
+
+// NewLRUCache returns an LRU cache that keeps up to size values.
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{
+		size:  size,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// Get returns the value stored under key.
+func (c *LRUCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+// Set stores value under key, evicting the least recently used value when
+// the cache is full.
+func (c *LRUCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		e.Value.(*lruEntry).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, value: value})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// Len returns the number of values in the cache.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// pendingInvalidations collects the collections changed by a transaction,
+// their cached results are invalidated once the transaction is committed.
+type pendingInvalidations struct {
+	collections map[string]bool
+	mu          sync.Mutex
+}
+
+func (p *pendingInvalidations) add(collection string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.collections == nil {
+		p.collections = make(map[string]bool)
+	}
+	p.collections[collection] = true
+}
+
+type hasCache interface {
+	resultCache() Cache
+	pendingInvalidations() *pendingInvalidations
+}
+
+// WithCache returns a copy of the session that caches the results of
+// Store.Get and Store.Cached in c. Cached results of a collection are
+// invalidated when a store of the session creates, updates or deletes an
+// item of the collection, changes made within a transaction invalidate the
+// cache after the transaction is committed. Transactions neither read from
+// nor write to the cache.
+//
+// Changes made by other sessions, or by queries that don't go through a
+// store, are not noticed.
+//
+// Results are encoded with encoding/gob: exported fields are kept whatever
+// their json tags, unexported fields are dropped, as they are when reading
+// from the database. Results that gob can't encode aren't cached.
+func (s *session) WithCache(c Cache) Session {
+	sess := s.clone(s.Backend)
+	sess.cache = c
+	if _, ok := s.Backend.(sqlbuilder.Tx); ok && sess.pending == nil {
+		sess.pending = &pendingInvalidations{}
+	}
+	return sess
+}
+
+func (s *session) resultCache() Cache {
+	return s.cache
+}
+
+func (s *session) pendingInvalidations() *pendingInvalidations {
+	return s.pending
+}
+
+// flushInvalidations invalidates the collections changed by the session's
+// committed transaction.
+func (s *session) flushInvalidations() {
+	if s.cache == nil || s.pending == nil {
+		return
+	}
+	s.pending.mu.Lock()
+	defer s.pending.mu.Unlock()
+	for collection := range s.pending.collections {
+		invalidateCollection(s.cache, collection)
+	}
+	s.pending.collections = nil
+}
+
+var cacheGeneration uint64
+
+// Cached results are keyed by the generation of their collection, a
+// collection is invalidated by giving it a new generation. A missing
+// generation, e.g. evicted, gets a new one as well so stale results can't be
+// read again.
+func generationKey(collection string) string {
+	return "bond:gen:" + collection
+}
+
+func newGeneration() []byte {
+	gen := strconv.FormatInt(time.Now().UnixNano(), 36) + "." +
+		strconv.FormatUint(atomic.AddUint64(&cacheGeneration, 1), 36)
+	return []byte(gen)
+}
+
+func invalidateCollection(c Cache, collection string) {
+	c.Set(generationKey(collection), newGeneration())
+}
+
+func collectionGeneration(c Cache, collection string) string {
+	gen, ok := c.Get(generationKey(collection))
+	if !ok {
+		gen = newGeneration()
+		c.Set(generationKey(collection), gen)
+	}
+	return string(gen)
+}
+
+// cache returns the session's cache, or nil when the store can't use it
+// because the session is a transaction.
+func (s *store) cache() Cache {
+	hc, ok := s.session.(hasCache)
+	if !ok || hc.pendingInvalidations() != nil {
+		return nil
+	}
+	return hc.resultCache()
+}
+
+// cacheKey returns the key of a cached result of the store, it identifies
+// the collection's generation and the tenant and scopes of the store.
+func (s *store) cacheKey(c Cache, kind string, key string) string {
+	var scope []string
+	if t, _ := s.tenantCond(); t != nil {
+		for column, value := range t {
+			scope = append(scope, fmt.Sprintf("%v=%v", column, value))
+		}
+		sort.Strings(scope)
+	}
+	if s.unscoped {
+		scope = append(scope, "unscoped")
+	}
+	scope = append(scope, s.scoped...)
+
+	collection := s.Collection.Name()
+	return strings.Join([]string{
+		"bond", collection, collectionGeneration(c, collection), kind, strings.Join(scope, ","), key,
+	}, ":")
+}
+
+// invalidateCache invalidates the cached results of the store's collection,
+// or schedules their invalidation if the session is a transaction.
+func (s *store) invalidateCache() {
+	hc, ok := s.session.(hasCache)
+	if !ok || hc.resultCache() == nil || s.Collection == nil {
+		return
+	}
+	if p := hc.pendingInvalidations(); p != nil {
+		p.add(s.Collection.Name())
+		return
+	}
+	invalidateCollection(hc.resultCache(), s.Collection.Name())
+}
+
+// Get fetches the item with the given primary key values into dest, in the
+// order of the store's primary keys. Items are read from the session's
+// cache, if any. Get fails with db.ErrNoMoreRows when there's no such item.
+func (s *store) Get(dest interface{}, keys ...interface{}) error {
+	if s.Collection == nil {
+		return ErrInvalidCollection
+	}
+
+	pk, ok := s.Collection.(hasPrimaryKeys)
+	if !ok || len(pk.PrimaryKeys()) != len(keys) || len(keys) == 0 {
+		return ErrInvalidQuery
+	}
+	cond := db.Cond{}
+	for i, pKey := range pk.PrimaryKeys() {
+		cond[pKey] = keys[i]
+	}
+
+	im := s.identities()
+	if im != nil && s.getMapped(im, dest, keys) {
+		return nil
+	}
+
+	key, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	err = s.cached("get", string(key), dest, func() error {
+		return s.Find(cond).One(dest)
+	})
+	if err == nil && im != nil {
+		im.resolveDest(s, dest)
+	}
+	return err
+}
+
+// getMapped sets dest, a **T or a *T, to the mapped item with the given
+// primary key values.
+func (s *store) getMapped(im *identityMap, dest interface{}, keys []interface{}) bool {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return false
+	}
+	typ := v.Type()
+	if typ.Elem().Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	item, ok := im.lookup(s, typ, keys)
+	if !ok {
+		return false
+	}
+	if typ == v.Type() {
+		v.Elem().Set(item.Elem())
+	} else {
+		v.Elem().Set(item)
+	}
+	return true
+}
+
+// Cached fetches the items matching conds into dest, a pointer to a slice,
+// or the first one when dest is a pointer to a struct. The result is cached
+// under the given key, which must identify conds, until the collection is
+// changed.
+func (s *store) Cached(key string, dest interface{}, conds ...interface{}) error {
+	if s.Collection == nil {
+		return ErrInvalidCollection
+	}
+
+	return s.cached("query", key, dest, func() error {
+		res := s.Find(conds...)
+		if v := reflect.ValueOf(dest); v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice {
+			return res.All(dest)
+		}
+		return res.One(dest)
+	})
+}
+
+func (s *store) cached(kind, key string, dest interface{}, fetch func() error) error {
+	c := s.cache()
+	if c == nil {
+		return fetch()
+	}
+
+	if _, err := s.tenantCond(); err != nil {
+		return err
+	}
+	cacheKey := s.cacheKey(c, kind, key)
+	if value, ok := c.Get(cacheKey); ok {
+		if err := decodeResult(value, dest); err == nil {
+			return nil
+		}
+	}
+
+	if err := fetch(); err != nil {
+		return err
+	}
+	if value, err := encodeResult(dest); err == nil {
+		c.Set(cacheKey, value)
+	}
+	return nil
+}
+
+func encodeResult(dest interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(dest); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeResult decodes a cached result into dest, which is reset first since
+// gob leaves fields with zero values untouched.
+func decodeResult(value []byte, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return ErrExpectingPointerToStruct
+	}
+	v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	return gob.NewDecoder(bytes.NewReader(value)).Decode(dest)
+}
@@ -0,0 +1,106 @@
+package bond_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/db.v3"
+)
+
+func TestLRUCache(t *testing.T) {
+	c := bond.NewLRUCache(2)
+
+	c.Set("a", []byte("1"))
+	c.Set("b", []byte("2"))
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+
+	c.Set("c", []byte("3"))
+	assert.Equal(t, 2, c.Len())
+
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+
+	value, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", string(value))
+}
+
+func TestCache(t *testing.T) {
+	dbReset()
+
+	sess := DB.WithCache(bond.NewLRUCache(100))
+	logs := sess.Store("logs")
+
+	l := &Log{Message: "one"}
+	assert.NoError(t, sess.Save(l))
+
+	var found Log
+	assert.NoError(t, logs.Get(&found, l.ID))
+	assert.Equal(t, "one", found.Message)
+
+	var all []Log
+	assert.NoError(t, logs.Cached("all", &all))
+	assert.Len(t, all, 1)
+
+	// Changes that don't go through the session's stores aren't noticed.
+	err := DB.Collection("logs").Find(db.Cond{"id": l.ID}).Update(map[string]interface{}{"message": "changed"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, logs.Get(&found, l.ID))
+	assert.Equal(t, "one", found.Message)
+
+	l.Message = "two"
+	assert.NoError(t, sess.Save(l))
+
+	assert.NoError(t, logs.Get(&found, l.ID))
+	assert.Equal(t, "two", found.Message)
+
+	// Changes made in a transaction invalidate the cache on commit.
+	tx, err := sess.NewSessionTx(nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, tx.Save(&Log{Message: "three"}))
+	assert.NoError(t, logs.Cached("all", &all))
+	assert.Len(t, all, 1)
+
+	assert.NoError(t, tx.TxCommit())
+	assert.NoError(t, logs.Cached("all", &all))
+	assert.Len(t, all, 2)
+
+	err = sess.SessionTx(nil, func(tx bond.Session) error {
+		return tx.Delete(l)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, db.ErrNoMoreRows, logs.Get(&found, l.ID))
+}
+
+// privateLog hides its columns from JSON.
+type privateLog struct {
+	ID      int64  `db:"id,omitempty" json:"-"`
+	Message string `db:"message" json:"-"`
+}
+
+func TestCacheEncoding(t *testing.T) {
+	dbReset()
+
+	sess := DB.WithCache(bond.NewLRUCache(100))
+	logs := sess.Store("logs")
+
+	l := &Log{Message: "private"}
+	assert.NoError(t, sess.Save(l))
+
+	var found privateLog
+	assert.NoError(t, logs.Get(&found, l.ID))
+	assert.Equal(t, "private", found.Message)
+
+	// The cached result keeps the columns hidden from JSON.
+	err := DB.Collection("logs").Find(db.Cond{"id": l.ID}).Update(map[string]interface{}{"message": "changed"})
+	assert.NoError(t, err)
+
+	found = privateLog{Message: "stale"}
+	assert.NoError(t, logs.Get(&found, l.ID))
+	assert.Equal(t, l.ID, found.ID)
+	assert.Equal(t, "private", found.Message)
+}
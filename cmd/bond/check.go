@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"upper.io/bond"
+)
+
+func schemaCheck(cfg *config, fs *flag.FlagSet, args []string) error {
+	dir := fs.String("dir", ".", "directory of the Go package declaring the models")
+	fs.Parse(args)
+
+	specs, err := parseModels(*dir)
+	if err != nil {
+		return err
+	}
+	if len(specs) == 0 {
+		return fmt.Errorf("no models found in %s", *dir)
+	}
+
+	sess, err := cfg.open()
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	problems, err := bond.CheckSpecs(sess, specs...)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return errors.New("schema drift detected")
+	}
+	fmt.Printf("%d models match the database\n", len(specs))
+	return nil
+}
+
+// parseModels returns the specs of the models declared in the Go package at
+// dir. Models are struct types with a Store method returning
+// sess.Store("collection"), or a CollectionName method returning a string
+// literal.
+func parseModels(dir string) ([]bond.ModelSpec, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	structs := make(map[string]*ast.StructType)
+	collections := make(map[string]string)
+	primaryKeys := make(map[string][]string)
+
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				switch d := decl.(type) {
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						if ts, ok := spec.(*ast.TypeSpec); ok {
+							if st, ok := ts.Type.(*ast.StructType); ok {
+								structs[ts.Name.Name] = st
+							}
+						}
+					}
+				case *ast.FuncDecl:
+					recv := receiverName(d)
+					if recv == "" || d.Body == nil {
+						continue
+					}
+					switch d.Name.Name {
+					case "Store":
+						if name, ok := returnedCall(d, "Store"); ok {
+							collections[recv] = name
+						}
+					case "CollectionName":
+						if name, ok := returnedString(d); ok {
+							collections[recv] = name
+						}
+					case "PrimaryKeys":
+						if keys, ok := returnedStrings(d); ok {
+							primaryKeys[recv] = keys
+						}
+					}
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(collections))
+	for name := range collections {
+		if _, ok := structs[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	specs := make([]bond.ModelSpec, 0, len(names))
+	for _, name := range names {
+		specs = append(specs, bond.ModelSpec{
+			Name:        name,
+			Collection:  collections[name],
+			Columns:     structColumns(structs[name], structs),
+			PrimaryKeys: primaryKeys[name],
+		})
+	}
+	return specs, nil
+}
+
+func structColumns(st *ast.StructType, structs map[string]*ast.StructType) []bond.ColumnSpec {
+	var columns []bond.ColumnSpec
+	for _, f := range st.Fields.List {
+		var tag string
+		if f.Tag != nil {
+			unquoted, _ := strconv.Unquote(f.Tag.Value)
+			tag = reflect.StructTag(unquoted).Get("db")
+		}
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name, inline := parts[0], false
+		for _, opt := range parts[1:] {
+			if opt == "inline" {
+				inline = true
+			}
+		}
+
+		typ := f.Type
+		for {
+			star, ok := typ.(*ast.StarExpr)
+			if !ok {
+				break
+			}
+			typ = star.X
+		}
+
+		if inline || (name == "" && len(f.Names) == 0) {
+			if ident, ok := typ.(*ast.Ident); ok && structs[ident.Name] != nil {
+				columns = append(columns, structColumns(structs[ident.Name], structs)...)
+			}
+			continue
+		}
+		if name == "" || len(f.Names) == 0 || !ast.IsExported(f.Names[0].Name) {
+			continue
+		}
+		columns = append(columns, bond.ColumnSpec{Name: name, GoType: typeName(typ)})
+	}
+	return columns
+}
+
+// typeName returns the name of a field type as bond.ColumnSpec expects it.
+// Types declared in the package keep their own name and aren't type checked.
+func typeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "byte":
+			return "uint8"
+		case "rune":
+			return "int32"
+		}
+		return t.Name
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok {
+			return pkg.Name + "." + t.Sel.Name
+		}
+	case *ast.ArrayType:
+		if elem, ok := t.Elt.(*ast.Ident); ok && t.Len == nil && (elem.Name == "byte" || elem.Name == "uint8") {
+			return "[]byte"
+		}
+	}
+	return "?"
+}
+
+func receiverName(d *ast.FuncDecl) string {
+	if d.Recv == nil || len(d.Recv.List) != 1 {
+		return ""
+	}
+	typ := d.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if ident, ok := typ.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// lastReturn returns the results of the last statement of d, if it's a
+// return statement with a single result.
+func lastReturn(d *ast.FuncDecl) ast.Expr {
+	if len(d.Body.List) == 0 {
+		return nil
+	}
+	ret, ok := d.Body.List[len(d.Body.List)-1].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 {
+		return nil
+	}
+	return ret.Results[0]
+}
+
+// returnedCall matches `return x.method("literal")`.
+func returnedCall(d *ast.FuncDecl, method string) (string, bool) {
+	call, ok := lastReturn(d).(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return "", false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != method {
+		return "", false
+	}
+	return stringLit(call.Args[0])
+}
+
+// returnedString matches `return "literal"`.
+func returnedString(d *ast.FuncDecl) (string, bool) {
+	return stringLit(lastReturn(d))
+}
+
+// returnedStrings matches `return []string{"literal", ...}`.
+func returnedStrings(d *ast.FuncDecl) ([]string, bool) {
+	lit, ok := lastReturn(d).(*ast.CompositeLit)
+	if !ok {
+		return nil, false
+	}
+	values := make([]string, 0, len(lit.Elts))
+	for _, elt := range lit.Elts {
+		s, ok := stringLit(elt)
+		if !ok {
+			return nil, false
+		}
+		values = append(values, s)
+	}
+	return values, true
+}
+
+func stringLit(expr ast.Expr) (string, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
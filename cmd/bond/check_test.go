@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+)
+
+func TestParseModels(t *testing.T) {
+	specs, err := parseModels("testdata/models")
+	if !assert.NoError(t, err) || !assert.Len(t, specs, 2) {
+		return
+	}
+
+	assert.Equal(t, bond.ModelSpec{
+		Name:       "Account",
+		Collection: "accounts",
+		Columns: []bond.ColumnSpec{
+			{Name: "id", GoType: "int64"},
+			{Name: "name", GoType: "string"},
+			{Name: "disabled", GoType: "bool"},
+			{Name: "created_at", GoType: "time.Time"},
+			{Name: "updated_at", GoType: "time.Time"},
+		},
+	}, specs[0])
+
+	assert.Equal(t, bond.ModelSpec{
+		Name:       "Membership",
+		Collection: "memberships",
+		Columns: []bond.ColumnSpec{
+			{Name: "account_id", GoType: "int64"},
+			{Name: "user_id", GoType: "int64"},
+			{Name: "data", GoType: "[]byte"},
+		},
+		PrimaryKeys: []string{"account_id", "user_id"},
+	}, specs[1])
+}
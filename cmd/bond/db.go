@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/lib/pq"
+)
+
+func dbReset(cfg *config, fs *flag.FlagSet, args []string) error {
+	schema := fs.String("schema", "", "SQL file to load into the new database")
+	fs.Parse(args)
+
+	admin, err := cfg.openAs(cfg.User, cfg.Password, "postgres")
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	database, user := pq.QuoteIdentifier(cfg.Database), pq.QuoteIdentifier(cfg.BondUser)
+	queries := []string{
+		"DROP DATABASE IF EXISTS " + database,
+		"DROP ROLE IF EXISTS " + user,
+		fmt.Sprintf("CREATE USER %s WITH PASSWORD %s", user, pq.QuoteLiteral(cfg.BondPassword)),
+		fmt.Sprintf("CREATE DATABASE %s ENCODING 'UTF-8' LC_COLLATE='en_US.UTF-8' LC_CTYPE='en_US.UTF-8' TEMPLATE template0", database),
+		fmt.Sprintf("GRANT ALL PRIVILEGES ON DATABASE %s TO %s", database, user),
+	}
+	for _, query := range queries {
+		if _, err := admin.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	if *schema == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(*schema)
+	if err != nil {
+		return err
+	}
+	sess, err := cfg.open()
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	_, err = sess.Exec(string(data))
+	return err
+}
+
+func schemaDump(cfg *config, fs *flag.FlagSet, args []string) error {
+	output := fs.String("o", "", "file to write the schema to (default: stdout)")
+	fs.Parse(args)
+
+	cmd := exec.Command("pg_dump", "--schema-only", "--no-owner", "--no-privileges",
+		"-h", cfg.Host, "-p", cfg.Port, "-U", cfg.BondUser, cfg.Database)
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+cfg.BondPassword)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		cmd.Stdout = f
+	}
+	return cmd.Run()
+}
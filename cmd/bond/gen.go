@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"upper.io/bond"
+	"upper.io/bond/gen"
+)
+
+func genModels(cfg *config, fs *flag.FlagSet, args []string) error {
+	pkg := fs.String("pkg", "models", "package of the generated file")
+	output := fs.String("o", "", "file to write the models to (default: stdout)")
+	fs.Parse(args)
+
+	sess, err := cfg.open()
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	tables, err := bond.Describe(sess, fs.Args()...)
+	if err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return gen.Models(w, *pkg, tables)
+}
@@ -0,0 +1,122 @@
+// Command bond runs schema migrations and database tasks.
+//
+// Usage:
+//
+//	bond migrate up [-dir migrations]
+//	bond migrate down [-dir migrations] [-to version]
+//	bond migrate status [-dir migrations]
+//	bond migrate create [-dir migrations] name
+//	bond db reset [-schema file.sql]
+//	bond schema dump [-o file.sql]
+//	bond schema check [-dir .]
+//	bond gen models [-pkg models] [-o models.go] [table...]
+//
+// Connection settings are read from the environment: DB_HOST, DB_PORT,
+// DB_USER and DB_PASSWORD for the administrative user, BOND_DB, BOND_USER and
+// BOND_PASSWORD for the application's database and user.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"upper.io/bond"
+	"upper.io/db.v3/postgresql"
+)
+
+type command struct {
+	name    string
+	usage   string
+	run     func(cfg *config, fs *flag.FlagSet, args []string) error
+	summary string
+}
+
+var commands = []command{
+	{"migrate up", "[-dir migrations] [-table name]", migrateUp, "apply pending migrations"},
+	{"migrate down", "[-dir migrations] [-table name] [-to version]", migrateDown, "revert migrations newer than a version"},
+	{"migrate status", "[-dir migrations] [-table name]", migrateStatus, "list migrations and whether they're applied"},
+	{"migrate create", "[-dir migrations] name", migrateCreate, "create empty up and down SQL files"},
+	{"db reset", "[-schema file.sql]", dbReset, "drop and create the database and its user"},
+	{"schema dump", "[-o file.sql]", schemaDump, "print the database schema with pg_dump"},
+	{"schema check", "[-dir .]", schemaCheck, "compare the models of a Go package with the database"},
+	{"gen models", "[-pkg models] [-o models.go] [table...]", genModels, "generate models from the database's tables"},
+}
+
+type config struct {
+	Host         string
+	Port         string
+	User         string
+	Password     string
+	Database     string
+	BondUser     string
+	BondPassword string
+}
+
+func pickDefault(env string, def string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	return def
+}
+
+func loadConfig() *config {
+	return &config{
+		Host:         pickDefault("DB_HOST", "127.0.0.1"),
+		Port:         pickDefault("DB_PORT", "5432"),
+		User:         pickDefault("DB_USER", "postgres"),
+		Password:     pickDefault("DB_PASSWORD", ""),
+		Database:     pickDefault("BOND_DB", "bond_test"),
+		BondUser:     pickDefault("BOND_USER", "bond_user"),
+		BondPassword: pickDefault("BOND_PASSWORD", "bond_password"),
+	}
+}
+
+// open connects to the application's database as the application's user.
+func (cfg *config) open() (bond.Session, error) {
+	return cfg.openAs(cfg.BondUser, cfg.BondPassword, cfg.Database)
+}
+
+func (cfg *config) openAs(user, password, database string) (bond.Session, error) {
+	return bond.Open(postgresql.Adapter, postgresql.ConnectionURL{
+		Host:     fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
+		Database: database,
+		User:     user,
+		Password: password,
+	})
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: bond <command> [arguments]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-15s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1] + " " + os.Args[2]
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		cmd := cmd
+		fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+		fs.Usage = func() {
+			fmt.Fprintf(os.Stderr, "usage: bond %s %s\n", cmd.name, cmd.usage)
+			fs.PrintDefaults()
+		}
+		if err := cmd.run(loadConfig(), fs, os.Args[3:]); err != nil {
+			fmt.Fprintf(os.Stderr, "bond %s: %v\n", cmd.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	usage()
+	os.Exit(2)
+}
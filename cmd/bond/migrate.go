@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"text/tabwriter"
+
+	"upper.io/bond/migrate"
+)
+
+// migrationFlags adds the flags shared by the migrate commands to fs.
+func migrationFlags(fs *flag.FlagSet) (dir, table *string) {
+	dir = fs.String("dir", "migrations", "directory of SQL migrations")
+	table = fs.String("table", migrate.DefaultTableName, "table applied versions are recorded in")
+	return dir, table
+}
+
+func newMigrator(cfg *config, dir, table string) (*migrate.Migrator, func(), error) {
+	sess, err := cfg.open()
+	if err != nil {
+		return nil, nil, err
+	}
+	m := migrate.New(sess)
+	m.TableName = table
+	if err := m.LoadDir(dir); err != nil {
+		sess.Close()
+		return nil, nil, err
+	}
+	return m, func() { sess.Close() }, nil
+}
+
+func migrateUp(cfg *config, fs *flag.FlagSet, args []string) error {
+	dir, table := migrationFlags(fs)
+	fs.Parse(args)
+
+	m, closeFn, err := newMigrator(cfg, *dir, *table)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	if err := m.Up(context.Background()); err != nil {
+		return err
+	}
+	return printVersion(m)
+}
+
+func migrateDown(cfg *config, fs *flag.FlagSet, args []string) error {
+	dir, table := migrationFlags(fs)
+	to := fs.Int64("to", -1, "version to revert to, 0 reverts every migration (default: revert the newest migration)")
+	fs.Parse(args)
+
+	m, closeFn, err := newMigrator(cfg, *dir, *table)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	ctx := context.Background()
+	target := *to
+	if target < 0 {
+		if target, err = previousVersion(ctx, m); err != nil {
+			return err
+		}
+	}
+
+	if err := m.Down(ctx, target); err != nil {
+		return err
+	}
+	return printVersion(m)
+}
+
+// previousVersion returns the version before the newest applied one.
+func previousVersion(ctx context.Context, m *migrate.Migrator) (int64, error) {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var applied []int64
+	for _, st := range status {
+		if st.Applied {
+			applied = append(applied, st.Version)
+		}
+	}
+	if len(applied) < 2 {
+		return 0, nil
+	}
+	return applied[len(applied)-2], nil
+}
+
+func migrateStatus(cfg *config, fs *flag.FlagSet, args []string) error {
+	dir, table := migrationFlags(fs)
+	fs.Parse(args)
+
+	m, closeFn, err := newMigrator(cfg, *dir, *table)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	status, err := m.Status(context.Background())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, st := range status {
+		appliedAt := "pending"
+		if st.Applied {
+			appliedAt = st.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", st.Version, st.Name, appliedAt)
+	}
+	return w.Flush()
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_.+\.(up|down)\.sql$`)
+var migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+func migrateCreate(cfg *config, fs *flag.FlagSet, args []string) error {
+	dir, _ := migrationFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	name := fs.Arg(0)
+	if !migrationName.MatchString(name) {
+		return fmt.Errorf("invalid name %q, use lowercase letters, digits and underscores", name)
+	}
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(*dir)
+	if err != nil {
+		return err
+	}
+
+	var version int64
+	for _, file := range files {
+		match := migrationFile.FindStringSubmatch(file.Name())
+		if match == nil {
+			continue
+		}
+		if v, _ := strconv.ParseInt(match[1], 10, 64); v > version {
+			version = v
+		}
+	}
+	version++
+
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(*dir, fmt.Sprintf("%04d_%s.%s.sql", version, name, direction))
+		contents := fmt.Sprintf("-- %s migration of %04d_%s\n", direction, version, name)
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			return err
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
+
+func printVersion(m *migrate.Migrator) error {
+	version, err := m.Version(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("version %d\n", version)
+	return nil
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"upper.io/bond"
+)
+
+type Timestamps struct {
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt *time.Time `db:"updated_at"`
+}
+
+type Account struct {
+	ID       int64  `db:"id,omitempty"`
+	Name     string `db:"name"`
+	Disabled bool   `db:"disabled"`
+	Notes    string `db:"-"`
+
+	Timestamps `db:",inline"`
+}
+
+func (a *Account) Store(sess bond.Session) bond.Store {
+	return sess.Store("accounts")
+}
+
+type Membership struct {
+	AccountID int64  `db:"account_id"`
+	UserID    int64  `db:"user_id"`
+	Data      []byte `db:"data"`
+	internal  string
+}
+
+func (m Membership) CollectionName() string {
+	return "memberships"
+}
+
+func (m Membership) PrimaryKeys() []string {
+	return []string{"account_id", "user_id"}
+}
+
+// NotAModel has no store.
+type NotAModel struct {
+	ID int64 `db:"id"`
+}
@@ -7,6 +7,19 @@ import (
 // Public errors
 var (
 	ErrExpectingPointerToStruct = errors.New(`Expecting pointer to struct`)
+	ErrExpectingPointerToSlice  = errors.New(`Expecting pointer to slice`)
 	ErrExpectingNonNilModel     = errors.New(`Expecting non nil model`)
 	ErrInvalidCollection        = errors.New(`Invalid collection`)
+	ErrMissingConnectionURL     = errors.New(`Missing connection URL`)
+	ErrMissingTenantField       = errors.New(`Missing tenant field`)
+	ErrTenantMismatch           = errors.New(`Item belongs to another tenant`)
+	ErrMissingTenantID          = errors.New(`Missing tenant ID`)
+	ErrMissingShardKey          = errors.New(`Missing shard key function`)
+	ErrMissingShards            = errors.New(`Missing shards`)
+	ErrExpectingIterateFunc     = errors.New(`Expecting func(*T) error`)
+	ErrInvalidCursor            = errors.New(`Invalid cursor`)
+	ErrNotInTx                  = errors.New(`Row locks can only be taken within a transaction`)
+	ErrAdvisoryLockNotAcquired  = errors.New(`Advisory lock was not acquired`)
+	ErrNotifyFailed             = errors.New(`Change notification failed`)
+	ErrUnknownScope             = errors.New(`Unknown scope`)
 )
@@ -0,0 +1,342 @@
+// Package gen generates bond models from introspected tables.
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"upper.io/bond"
+)
+
+// Models writes a Go source file of package pkg with a model struct, a Store
+// method and a typed store for each table, plus methods to load the records
+// related through single column foreign keys.
+func Models(w io.Writer, pkg string, tables []bond.Table) error {
+	file := &file{Package: pkg}
+
+	models := make(map[string]*model, len(tables))
+	for _, t := range tables {
+		m := newModel(t)
+		models[t.Name] = m
+		file.Models = append(file.Models, m)
+		for _, f := range m.Fields {
+			if f.Import != "" {
+				file.addImport(f.Import)
+			}
+		}
+	}
+
+	for _, t := range tables {
+		for _, fk := range t.ForeignKeys {
+			if len(fk.Columns) != 1 {
+				continue
+			}
+			from, to := models[t.Name], models[fk.RefTable]
+			if to == nil {
+				continue
+			}
+			if from.fieldFor(fk.Columns[0]) == "" {
+				return fmt.Errorf("gen: foreign key %s references unknown column %s.%s", fk.Name, t.Name, fk.Columns[0])
+			}
+			if to.fieldFor(fk.RefColumns[0]) == "" {
+				return fmt.Errorf("gen: foreign key %s references unknown column %s.%s", fk.Name, fk.RefTable, fk.RefColumns[0])
+			}
+			from.addBelongsTo(fk, to)
+			to.addHasMany(fk, from)
+		}
+	}
+	for _, m := range file.Models {
+		m.resolveNames()
+	}
+
+	var buf bytes.Buffer
+	if err := fileTemplate.Execute(&buf, file); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("gen: formatting source: %v", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+type file struct {
+	Package string
+	Imports []string
+	Models  []*model
+}
+
+func (f *file) addImport(path string) {
+	for _, imp := range f.Imports {
+		if imp == path {
+			return
+		}
+	}
+	f.Imports = append(f.Imports, path)
+	sort.Strings(f.Imports)
+}
+
+type model struct {
+	Name      string
+	Table     string
+	Receiver  string
+	Fields    []*field
+	Relations []*relation
+}
+
+type field struct {
+	Name   string
+	Type   string
+	Tag    string
+	Import string
+}
+
+type relation struct {
+	Method  string
+	Many    bool
+	Model   *model
+	Column  string // column of the queried table
+	Field   string // field of the receiver the column is matched to
+	byField string // disambiguates relations that share a method name
+}
+
+func newModel(t bond.Table) *model {
+	m := &model{
+		Name:  singular(exportedName(t.Name)),
+		Table: t.Name,
+	}
+	m.Receiver = strings.ToLower(m.Name[:1])
+
+	pKey := ""
+	if len(t.PrimaryKey) == 1 {
+		pKey = t.PrimaryKey[0]
+	}
+	for _, c := range t.Columns {
+		typ, imp := goType(c)
+		tag := c.Name
+		if c.Name == pKey && typ == "int64" {
+			tag += ",omitempty"
+		}
+		m.Fields = append(m.Fields, &field{
+			Name:   exportedName(c.Name),
+			Type:   typ,
+			Tag:    tag,
+			Import: imp,
+		})
+	}
+	return m
+}
+
+func (m *model) fieldFor(column string) string {
+	name := exportedName(column)
+	for _, f := range m.Fields {
+		if f.Name == name {
+			return f.Name
+		}
+	}
+	return ""
+}
+
+func (m *model) addBelongsTo(fk bond.ForeignKey, to *model) {
+	method := exportedName(strings.TrimSuffix(fk.Columns[0], "_id"))
+	if method == exportedName(fk.Columns[0]) {
+		method = to.Name
+	}
+	m.Relations = append(m.Relations, &relation{
+		Method:  method,
+		Model:   to,
+		Column:  fk.RefColumns[0],
+		Field:   m.fieldFor(fk.Columns[0]),
+		byField: exportedName(fk.Columns[0]),
+	})
+}
+
+func (m *model) addHasMany(fk bond.ForeignKey, from *model) {
+	m.Relations = append(m.Relations, &relation{
+		Method:  plural(from.Name),
+		Many:    true,
+		Model:   from,
+		Column:  fk.Columns[0],
+		Field:   m.fieldFor(fk.RefColumns[0]),
+		byField: exportedName(fk.Columns[0]),
+	})
+}
+
+// resolveNames renames relations whose method collides with a field or with
+// another relation.
+func (m *model) resolveNames() {
+	taken := make(map[string]int)
+	for _, f := range m.Fields {
+		taken[f.Name]++
+	}
+	for _, r := range m.Relations {
+		taken[r.Method]++
+	}
+	for _, r := range m.Relations {
+		if taken[r.Method] > 1 {
+			r.Method = r.Method + "By" + r.byField
+		}
+	}
+}
+
+// goType returns the Go type of a column, and the package it needs.
+func goType(c bond.Column) (string, string) {
+	typ, imp := baseType(c.Type)
+	if c.Nullable && typ != "[]byte" {
+		typ = "*" + typ
+	}
+	return typ, imp
+}
+
+func baseType(dbType string) (string, string) {
+	t := strings.ToLower(dbType)
+
+	// MySQL booleans are tinyint(1), other tinyint columns are integers.
+	if strings.HasPrefix(t, "tinyint(1)") {
+		return "bool", ""
+	}
+	unsigned := strings.HasSuffix(t, " unsigned")
+	if i := strings.IndexAny(t, "(["); i >= 0 {
+		t = strings.TrimSpace(t[:i])
+	}
+
+	switch {
+	case t == "boolean" || t == "bool":
+		return "bool", ""
+	case t == "tinyint" && unsigned:
+		return "uint8", ""
+	case t == "tinyint":
+		return "int8", ""
+	case t == "smallint" || t == "int2" || t == "smallserial":
+		return "int16", ""
+	case t == "integer" || t == "int" || t == "int4" || t == "serial" || t == "mediumint",
+		t == "bigint" || t == "int8" || t == "bigserial":
+		return "int64", ""
+	case t == "real" || t == "float4" || t == "float":
+		return "float32", ""
+	case t == "double precision" || t == "double" || t == "float8" || t == "numeric" || t == "decimal":
+		return "float64", ""
+	case strings.HasPrefix(t, "timestamp") || t == "date" || t == "datetime" || strings.HasPrefix(t, "time"):
+		return "time.Time", "time"
+	case t == "bytea" || strings.HasSuffix(t, "blob") || strings.HasSuffix(t, "binary") || t == "json" || t == "jsonb":
+		return "[]byte", ""
+	}
+	return "string", ""
+}
+
+// commonInitialisms are spelled in upper case in Go names.
+var commonInitialisms = map[string]bool{
+	"API": true, "HTML": true, "HTTP": true, "ID": true, "IP": true,
+	"JSON": true, "SQL": true, "URI": true, "URL": true, "UUID": true,
+}
+
+// exportedName converts a snake_case name to an exported Go name.
+func exportedName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if upper := strings.ToUpper(part); commonInitialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	s := b.String()
+	if s == "" || unicode.IsDigit(rune(s[0])) {
+		s = "X" + s
+	}
+	return s
+}
+
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"), strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		return name[:len(name)-2]
+	case strings.HasSuffix(name, "ss"), strings.HasSuffix(name, "us"):
+		return name
+	case strings.HasSuffix(name, "s"):
+		return name[:len(name)-1]
+	}
+	return name
+}
+
+func plural(name string) string {
+	switch {
+	case strings.HasSuffix(name, "y") && !strings.HasSuffix(name, "ey"):
+		return name[:len(name)-1] + "ies"
+	case strings.HasSuffix(name, "s"), strings.HasSuffix(name, "x"), strings.HasSuffix(name, "ch"), strings.HasSuffix(name, "sh"):
+		return name + "es"
+	}
+	return name + "s"
+}
+
+var fileTemplate = template.Must(template.New("models").Parse(`// Code generated by bond gen models. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+
+	"upper.io/bond"
+	"upper.io/db.v3"
+)
+
+{{range $m := .Models}}
+type {{$m.Name}} struct {
+{{- range $m.Fields}}
+	{{.Name}} {{.Type}} ` + "`db:\"{{.Tag}}\"`" + `
+{{- end}}
+}
+
+func ({{$m.Receiver}} *{{$m.Name}}) Store(sess bond.Session) bond.Store {
+	return sess.Store("{{$m.Table}}")
+}
+{{range $r := $m.Relations}}
+{{- if $r.Many}}
+func ({{$m.Receiver}} *{{$m.Name}}) {{$r.Method}}(sess bond.Session) ([]*{{$r.Model.Name}}, error) {
+	var items []*{{$r.Model.Name}}
+	err := sess.Store("{{$r.Model.Table}}").Find(db.Cond{"{{$r.Column}}": {{$m.Receiver}}.{{$r.Field}}}).All(&items)
+	return items, err
+}
+{{else}}
+func ({{$m.Receiver}} *{{$m.Name}}) {{$r.Method}}(sess bond.Session) (*{{$r.Model.Name}}, error) {
+	var item *{{$r.Model.Name}}
+	err := sess.Store("{{$r.Model.Table}}").Find(db.Cond{"{{$r.Column}}": {{$m.Receiver}}.{{$r.Field}}}).One(&item)
+	return item, err
+}
+{{end}}
+{{- end}}
+type {{$m.Name}}Store struct {
+	bond.Store
+}
+
+func New{{$m.Name}}Store(sess bond.Session) {{$m.Name}}Store {
+	return {{$m.Name}}Store{Store: sess.Store("{{$m.Table}}")}
+}
+
+func (s {{$m.Name}}Store) FindOne(cond db.Cond) (*{{$m.Name}}, error) {
+	var item *{{$m.Name}}
+	err := s.Find(cond).One(&item)
+	return item, err
+}
+
+func (s {{$m.Name}}Store) FindAll(cond db.Cond) ([]*{{$m.Name}}, error) {
+	var items []*{{$m.Name}}
+	err := s.Find(cond).All(&items)
+	return items, err
+}
+{{end}}`))
@@ -0,0 +1,124 @@
+package gen
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+)
+
+var tables = []bond.Table{
+	{
+		Name: "accounts",
+		Columns: []bond.Column{
+			{Name: "id", Type: "integer"},
+			{Name: "name", Type: "character varying", Nullable: true},
+			{Name: "disabled", Type: "boolean", Nullable: true},
+			{Name: "created_at", Type: "timestamp with time zone", Nullable: true},
+		},
+		PrimaryKey: []string{"id"},
+	},
+	{
+		Name: "users",
+		Columns: []bond.Column{
+			{Name: "id", Type: "integer"},
+			{Name: "account_id", Type: "integer"},
+			{Name: "username", Type: "varchar(256)"},
+		},
+		PrimaryKey: []string{"id"},
+		ForeignKeys: []bond.ForeignKey{
+			{Name: "users_account_id_fkey", Columns: []string{"account_id"}, RefTable: "accounts", RefColumns: []string{"id"}},
+		},
+	},
+}
+
+func TestModels(t *testing.T) {
+	var buf bytes.Buffer
+	err := Models(&buf, "models", tables)
+	if !assert.NoError(t, err) {
+		return
+	}
+	src := buf.String()
+
+	assert.Contains(t, src, "package models")
+	assert.Contains(t, src, "\t\"time\"\n")
+	assert.Contains(t, src, "type Account struct {")
+	assert.Contains(t, src, "ID        int64      `db:\"id,omitempty\"`")
+	assert.Contains(t, src, "CreatedAt *time.Time `db:\"created_at\"`")
+	assert.Contains(t, src, "Username  string `db:\"username\"`")
+	assert.Contains(t, src, `return sess.Store("users")`)
+	assert.Contains(t, src, "func (u *User) Account(sess bond.Session) (*Account, error) {")
+	assert.Contains(t, src, `Find(db.Cond{"id": u.AccountID}).One(&item)`)
+	assert.Contains(t, src, "func (a *Account) Users(sess bond.Session) ([]*User, error) {")
+	assert.Contains(t, src, `Find(db.Cond{"account_id": a.ID}).All(&items)`)
+	assert.Contains(t, src, "type UserStore struct {")
+	assert.Contains(t, src, "func (s AccountStore) FindOne(cond db.Cond) (*Account, error) {")
+}
+
+func TestNames(t *testing.T) {
+	assert.Equal(t, "AccountID", exportedName("account_id"))
+	assert.Equal(t, "APIURL", exportedName("api_url"))
+	assert.Equal(t, "Category", singular("Categories"))
+	assert.Equal(t, "Address", singular("Addresses"))
+	assert.Equal(t, "Status", singular("Status"))
+	assert.Equal(t, "Categories", plural("Category"))
+	assert.Equal(t, "Keys", plural("Key"))
+}
+
+func TestRelationNames(t *testing.T) {
+	messages := bond.Table{
+		Name: "messages",
+		Columns: []bond.Column{
+			{Name: "id", Type: "bigint"},
+			{Name: "sender_id", Type: "bigint"},
+			{Name: "recipient_id", Type: "bigint"},
+		},
+		PrimaryKey: []string{"id"},
+		ForeignKeys: []bond.ForeignKey{
+			{Name: "fk_sender", Columns: []string{"sender_id"}, RefTable: "users", RefColumns: []string{"id"}},
+			{Name: "fk_recipient", Columns: []string{"recipient_id"}, RefTable: "users", RefColumns: []string{"id"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := Models(&buf, "models", append(tables, messages))
+	if !assert.NoError(t, err) {
+		return
+	}
+	src := buf.String()
+
+	assert.Contains(t, src, "func (m *Message) Sender(sess bond.Session) (*User, error) {")
+	assert.Contains(t, src, "func (m *Message) Recipient(sess bond.Session) (*User, error) {")
+	assert.Contains(t, src, "func (u *User) MessagesBySenderID(sess bond.Session) ([]*Message, error) {")
+	assert.Contains(t, src, "func (u *User) MessagesByRecipientID(sess bond.Session) ([]*Message, error) {")
+}
+
+func TestBaseType(t *testing.T) {
+	for dbType, goType := range map[string]string{
+		"tinyint(1)":          "bool",
+		"tinyint(4)":          "int8",
+		"tinyint":             "int8",
+		"tinyint(3) unsigned": "uint8",
+		"boolean":             "bool",
+		"int(11)":             "int64",
+	} {
+		typ, _ := baseType(dbType)
+		assert.Equal(t, goType, typ, dbType)
+	}
+}
+
+func TestUnknownForeignKeyColumn(t *testing.T) {
+	posts := bond.Table{
+		Name:       "posts",
+		Columns:    []bond.Column{{Name: "id", Type: "bigint"}},
+		PrimaryKey: []string{"id"},
+		ForeignKeys: []bond.ForeignKey{
+			{Name: "fk_author", Columns: []string{"author_id"}, RefTable: "users", RefColumns: []string{"id"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := Models(&buf, "models", append(tables, posts))
+	assert.EqualError(t, err, "gen: foreign key fk_author references unknown column posts.author_id")
+}
@@ -0,0 +1,378 @@
+package bond
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	"upper.io/db.v3"
+)
+
+// identityMap maps the primary keys of the items loaded by a session to the
+// pointers holding them. Transactions get a child map, merged into its parent
+// on commit and dropped on rollback, along with the parent's items the
+// transaction wrote.
+type identityMap struct {
+	items  map[identityKey]reflect.Value
+	parent *identityMap
+
+	// Changes to the parent's items, settled at the end of the transaction.
+	touched map[identityKey]bool
+	removed map[identityKey]bool
+	cleared map[string]bool
+
+	// mu is shared by a map and its children.
+	mu *sync.Mutex
+}
+
+func newIdentityMap() *identityMap {
+	return &identityMap{
+		items:   make(map[identityKey]reflect.Value),
+		touched: make(map[identityKey]bool),
+		removed: make(map[identityKey]bool),
+		cleared: make(map[string]bool),
+		mu:      &sync.Mutex{},
+	}
+}
+
+// child returns the map of a transaction started from a session with m.
+func (m *identityMap) child() *identityMap {
+	if m == nil {
+		return nil
+	}
+	c := newIdentityMap()
+	c.parent = m
+	c.mu = m.mu
+	return c
+}
+
+type identityKey struct {
+	typ        reflect.Type
+	collection string
+	pKey       string
+}
+
+type hasIdentityMap interface {
+	identities() *identityMap
+}
+
+// WithIdentityMap returns a copy of the session that keeps an identity map:
+// stores of the session, and of the sessions derived from it like its
+// transactions, return the same pointer each time they load the item with a
+// given primary key, so an item loaded twice can't diverge.
+//
+// Pointers are reused by Get, Iterate, Page and the One and All methods of
+// Find's result sets when their destination holds pointers, e.g. **Account
+// or *[]*Account. Items created by stores are added to the map, updated items
+// are copied into the mapped pointer and deleted items are removed from the
+// map. Bulk updates and deletes of result sets clear the map of the
+// collection. The map lives as long as the session, use it with short-lived
+// sessions like the session of a request or a transaction.
+//
+// Transactions started from the session see its items, the items they load
+// or write are added to the session's map once they're committed. Rolling
+// back a transaction removes the items it wrote from the session's map.
+func (s *session) WithIdentityMap() Session {
+	sess := s.clone(s.Backend)
+	sess.identityMap = newIdentityMap()
+	return sess
+}
+
+func (s *session) identities() *identityMap {
+	return s.identityMap
+}
+
+func (s *store) identities() *identityMap {
+	if s.Collection == nil {
+		return nil
+	}
+	if _, ok := s.Collection.(hasPrimaryKeys); !ok {
+		return nil
+	}
+	if hi, ok := s.session.(hasIdentityMap); ok {
+		return hi.identities()
+	}
+	return nil
+}
+
+// identityKey returns the key of item, a pointer to a struct, and whether the
+// item has a primary key.
+func (s *store) identityKey(item reflect.Value) (identityKey, bool) {
+	if item.Kind() != reflect.Ptr || item.IsNil() || item.Elem().Kind() != reflect.Struct {
+		return identityKey{}, false
+	}
+	pKeys, values := s.getPrimaryKeyFields(item.Interface())
+	if len(values) != len(pKeys) {
+		return identityKey{}, false
+	}
+	for _, v := range values {
+		if reflect.ValueOf(v).IsZero() {
+			return identityKey{}, false
+		}
+	}
+	return s.newIdentityKey(item.Type(), values)
+}
+
+func (s *store) newIdentityKey(typ reflect.Type, values []interface{}) (identityKey, bool) {
+	pKey, err := json.Marshal(values)
+	if err != nil {
+		return identityKey{}, false
+	}
+	return identityKey{typ: typ, collection: s.Collection.Name(), pKey: string(pKey)}, true
+}
+
+// get returns the item mapped to key, by m or its ancestors. m.mu must be
+// held.
+func (m *identityMap) get(key identityKey) (reflect.Value, bool) {
+	if item, ok := m.items[key]; ok {
+		return item, true
+	}
+	if m.parent == nil || m.removed[key] || m.cleared[key.collection] {
+		return reflect.Value{}, false
+	}
+	return m.parent.get(key)
+}
+
+// resolve returns the mapped pointer of item, mapping item itself if its key
+// wasn't mapped yet.
+func (m *identityMap) resolve(s *store, item reflect.Value) reflect.Value {
+	key, ok := s.identityKey(item)
+	if !ok {
+		return item
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if mapped, ok := m.get(key); ok {
+		return mapped
+	}
+	m.items[key] = item
+	return item
+}
+
+// lookup returns the item of the given type and primary key values.
+func (m *identityMap) lookup(s *store, typ reflect.Type, values []interface{}) (reflect.Value, bool) {
+	key, ok := s.newIdentityKey(typ, values)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.get(key)
+}
+
+// sync copies item into its mapped pointer, or maps item.
+func (m *identityMap) sync(s *store, item reflect.Value) {
+	key, ok := s.identityKey(item)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.touched[key] = true
+	delete(m.removed, key)
+	if mapped, ok := m.get(key); ok {
+		if mapped.Pointer() != item.Pointer() {
+			mapped.Elem().Set(item.Elem())
+		}
+		return
+	}
+	m.items[key] = item
+}
+
+func (m *identityMap) remove(s *store, item reflect.Value) {
+	key, ok := s.identityKey(item)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, key)
+	m.touched[key] = true
+	m.removed[key] = true
+}
+
+func (m *identityMap) clear(collection string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clearLocked(collection)
+}
+
+func (m *identityMap) clearLocked(collection string) {
+	for key := range m.items {
+		if key.collection == collection {
+			delete(m.items, key)
+		}
+	}
+	if m.parent != nil {
+		m.cleared[collection] = true
+	}
+}
+
+// commit merges the map of a committed transaction into its parent.
+func (m *identityMap) commit() {
+	if m == nil || m.parent == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := m.parent
+	for collection := range m.cleared {
+		p.clearLocked(collection)
+	}
+	for key := range m.removed {
+		delete(p.items, key)
+		if p.parent != nil {
+			p.removed[key] = true
+		}
+	}
+	if p.parent != nil {
+		for key := range m.touched {
+			p.touched[key] = true
+		}
+	}
+	for key, item := range m.items {
+		p.items[key] = item
+		delete(p.removed, key)
+	}
+	m.reset()
+}
+
+// rollback drops the map of a rolled back transaction, and the items of its
+// ancestors the transaction wrote since their values were rolled back.
+func (m *identityMap) rollback() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.touched {
+		for p := m.parent; p != nil; p = p.parent {
+			delete(p.items, key)
+		}
+	}
+	m.reset()
+}
+
+func (m *identityMap) reset() {
+	m.items = make(map[identityKey]reflect.Value)
+	m.touched = make(map[identityKey]bool)
+	m.removed = make(map[identityKey]bool)
+	m.cleared = make(map[string]bool)
+}
+
+// resolveDest replaces the pointers held by dest, a **T or a *[]*T, with
+// their mapped pointers.
+func (m *identityMap) resolveDest(s *store, dest interface{}) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return
+	}
+	v = v.Elem()
+	switch v.Kind() {
+	case reflect.Ptr:
+		v.Set(m.resolve(s, v))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Ptr {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			v.Index(i).Set(m.resolve(s, v.Index(i)))
+		}
+	}
+}
+
+// identityResult is a result set that maps the items it loads.
+type identityResult struct {
+	db.Result
+
+	store    *store
+	selected bool
+}
+
+var _ db.Result = &identityResult{}
+
+func (r *identityResult) wrap(res db.Result) db.Result {
+	return &identityResult{Result: res, store: r.store, selected: r.selected}
+}
+
+func (r *identityResult) Limit(n int) db.Result {
+	return r.wrap(r.Result.Limit(n))
+}
+
+func (r *identityResult) Offset(n int) db.Result {
+	return r.wrap(r.Result.Offset(n))
+}
+
+func (r *identityResult) OrderBy(v ...interface{}) db.Result {
+	return r.wrap(r.Result.OrderBy(v...))
+}
+
+// Select returns a result set that doesn't map its items, they'd be
+// partially loaded.
+func (r *identityResult) Select(v ...interface{}) db.Result {
+	return &identityResult{Result: r.Result.Select(v...), store: r.store, selected: true}
+}
+
+func (r *identityResult) Where(v ...interface{}) db.Result {
+	return r.wrap(r.Result.Where(v...))
+}
+
+func (r *identityResult) And(v ...interface{}) db.Result {
+	return r.wrap(r.Result.And(v...))
+}
+
+func (r *identityResult) Group(v ...interface{}) db.Result {
+	return r.wrap(r.Result.Group(v...))
+}
+
+func (r *identityResult) Paginate(pageSize uint) db.Result {
+	return r.wrap(r.Result.Paginate(pageSize))
+}
+
+func (r *identityResult) Page(pageNumber uint) db.Result {
+	return r.wrap(r.Result.Page(pageNumber))
+}
+
+func (r *identityResult) Cursor(cursorColumn string) db.Result {
+	return r.wrap(r.Result.Cursor(cursorColumn))
+}
+
+func (r *identityResult) NextPage(cursorValue interface{}) db.Result {
+	return r.wrap(r.Result.NextPage(cursorValue))
+}
+
+func (r *identityResult) PrevPage(cursorValue interface{}) db.Result {
+	return r.wrap(r.Result.PrevPage(cursorValue))
+}
+
+func (r *identityResult) One(dest interface{}) error {
+	if err := r.Result.One(dest); err != nil {
+		return err
+	}
+	if !r.selected {
+		r.store.identities().resolveDest(r.store, dest)
+	}
+	return nil
+}
+
+func (r *identityResult) All(dest interface{}) error {
+	if err := r.Result.All(dest); err != nil {
+		return err
+	}
+	if !r.selected {
+		r.store.identities().resolveDest(r.store, dest)
+	}
+	return nil
+}
+
+func (r *identityResult) Update(v interface{}) error {
+	defer r.store.identities().clear(r.store.Collection.Name())
+	return r.Result.Update(v)
+}
+
+func (r *identityResult) Delete() error {
+	defer r.store.identities().clear(r.store.Collection.Name())
+	return r.Result.Delete()
+}
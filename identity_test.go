@@ -0,0 +1,100 @@
+package bond_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/db.v3"
+)
+
+func TestIdentityMap(t *testing.T) {
+	dbReset()
+
+	sess := DB.WithIdentityMap()
+	logs := sess.Store("logs")
+
+	created := &Log{Message: "one"}
+	assert.NoError(t, sess.Save(created))
+
+	var found *Log
+	assert.NoError(t, logs.Find(db.Cond{"id": created.ID}).One(&found))
+	assert.True(t, found == created)
+
+	var got *Log
+	assert.NoError(t, logs.Get(&got, created.ID))
+	assert.True(t, got == created)
+
+	var all []*Log
+	assert.NoError(t, logs.Find().All(&all))
+	assert.Len(t, all, 1)
+	assert.True(t, all[0] == created)
+
+	// Updates of a copy are seen by the mapped pointer.
+	update := &Log{ID: created.ID, Message: "two"}
+	assert.NoError(t, sess.Save(update))
+	assert.Equal(t, "two", created.Message)
+
+	err := logs.Iterate(nil, func(l *Log) error {
+		assert.True(t, l == created)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// Sessions without the map load new pointers.
+	var other *Log
+	assert.NoError(t, DB.Log.Find(db.Cond{"id": created.ID}).One(&other))
+	assert.False(t, other == created)
+
+	assert.NoError(t, sess.Delete(created))
+	assert.Equal(t, db.ErrNoMoreRows, logs.Get(&got, created.ID))
+
+	// Bulk updates clear the map of the collection.
+	assert.NoError(t, sess.Save(&Log{Message: "three"}))
+	assert.NoError(t, logs.Find().One(&found))
+	assert.NoError(t, logs.Find().Update(map[string]interface{}{"message": "four"}))
+	assert.NoError(t, logs.Find().One(&other))
+	assert.False(t, found == other)
+	assert.Equal(t, "four", other.Message)
+}
+
+func TestIdentityMapRollback(t *testing.T) {
+	dbReset()
+
+	sess := DB.WithIdentityMap()
+	logs := sess.Store("logs")
+
+	kept := &Log{Message: "one"}
+	assert.NoError(t, sess.Save(kept))
+
+	var created *Log
+	errRollback := errors.New("rollback")
+	err := sess.SessionTx(context.Background(), func(tx bond.Session) error {
+		created = &Log{Message: "two"}
+		if err := tx.Save(created); err != nil {
+			return err
+		}
+		if err := tx.Save(&Log{ID: kept.ID, Message: "three"}); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	assert.Equal(t, errRollback, err)
+
+	// Neither the created item nor the update survive the rollback.
+	var got *Log
+	assert.Equal(t, db.ErrNoMoreRows, logs.Get(&got, created.ID))
+	assert.NoError(t, logs.Get(&got, kept.ID))
+	assert.Equal(t, "one", got.Message)
+
+	// Committed transactions merge their items into the session's map.
+	err = sess.SessionTx(context.Background(), func(tx bond.Session) error {
+		created = &Log{Message: "four"}
+		return tx.Save(created)
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, logs.Get(&got, created.ID))
+	assert.True(t, got == created)
+}
@@ -0,0 +1,339 @@
+package bond
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"upper.io/db.v3"
+)
+
+// Table describes a database table.
+type Table struct {
+	Name        string
+	Columns     []Column
+	PrimaryKey  []string
+	ForeignKeys []ForeignKey
+}
+
+// Column describes a column of a table.
+type Column struct {
+	Name     string
+	Type     string
+	Nullable bool
+}
+
+// ForeignKey describes a foreign key of a table, Columns reference
+// RefColumns of RefTable in order.
+type ForeignKey struct {
+	Name       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+}
+
+// Column returns the column with the given name, or nil if the table has no
+// such column.
+func (t *Table) Column(name string) *Column {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
+const (
+	dialectPostgreSQL = "postgresql"
+	dialectMySQL      = "mysql"
+	dialectSQLite     = "sqlite"
+)
+
+// dialect returns the SQL dialect of the session, detected from the package
+// of its database/sql driver, or of its connection URL for transactions.
+func dialect(sess Session) (string, error) {
+	var pkgPath string
+	if sqlDB, ok := sess.Driver().(*sql.DB); ok {
+		pkgPath = typePkgPath(sqlDB.Driver())
+	} else if url := sess.ConnectionURL(); url != nil {
+		pkgPath = typePkgPath(url)
+	} else {
+		return "", errors.Errorf("bond: can't detect the dialect of a %T", sess.Driver())
+	}
+
+	switch {
+	case strings.HasSuffix(pkgPath, "/pq"), strings.Contains(pkgPath, "pgx"),
+		strings.HasSuffix(pkgPath, "/postgresql"):
+		return dialectPostgreSQL, nil
+	case strings.HasSuffix(pkgPath, "/mysql"):
+		return dialectMySQL, nil
+	case strings.Contains(pkgPath, "sqlite"):
+		return dialectSQLite, nil
+	}
+	return "", errors.Errorf("bond: unsupported driver %s", pkgPath)
+}
+
+func typePkgPath(v interface{}) string {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.PkgPath()
+}
+
+// Describe introspects the given tables, or every table of the database when
+// no table is given. Tables are looked up in the session's schema (see
+// WithSchema) unless their name is qualified, or in the current schema.
+// Missing tables fail with an error whose cause is
+// db.ErrCollectionDoesNotExist.
+func Describe(sess Session, tables ...string) ([]Table, error) {
+	d, err := dialect(sess)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tables) == 0 {
+		if tables, err = tableNames(sess, d); err != nil {
+			return nil, err
+		}
+	}
+
+	described := make([]Table, 0, len(tables))
+	for _, name := range tables {
+		t := Table{Name: name}
+		if d == dialectSQLite {
+			err = describeSQLite(sess, &t)
+		} else {
+			err = describeInformationSchema(sess, d, &t)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "bond: describing %s", name)
+		}
+		if len(t.Columns) == 0 {
+			return nil, errors.Wrapf(db.ErrCollectionDoesNotExist, "bond: %s", name)
+		}
+		described = append(described, t)
+	}
+	return described, nil
+}
+
+func tableNames(sess Session, d string) ([]string, error) {
+	schema, args := schemaOf(sess, d, "")
+	var query string
+	switch d {
+	case dialectPostgreSQL, dialectMySQL:
+		query = `SELECT table_name FROM information_schema.tables
+			WHERE table_schema = ` + schema + ` AND table_type = 'BASE TABLE'
+			ORDER BY table_name`
+	case dialectSQLite:
+		query = `SELECT name FROM sqlite_master
+			WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+			ORDER BY name`
+		args = nil
+	}
+
+	rows, err := sess.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// schemaOf returns the SQL expression of the schema of the given table, and its
+// arguments followed by the table's unqualified name. Tables are looked up in
+// the session's schema, or in the current schema (database, on MySQL).
+func schemaOf(sess Session, d, name string) (string, []interface{}) {
+	schema, table := qualifiedTable(sess, name)
+	if schema != "" {
+		return "?", []interface{}{schema, table}
+	}
+	if d == dialectMySQL {
+		return "DATABASE()", []interface{}{table}
+	}
+	return "current_schema()", []interface{}{table}
+}
+
+func describeInformationSchema(sess Session, d string, t *Table) error {
+	schema, args := schemaOf(sess, d, t.Name)
+
+	// MySQL's column_type keeps the display width that tells tinyint(1)
+	// booleans from integers.
+	typeColumn := "data_type"
+	if d == dialectMySQL {
+		typeColumn = "column_type"
+	}
+
+	rows, err := sess.Query(`SELECT column_name, `+typeColumn+`, is_nullable
+		FROM information_schema.columns
+		WHERE table_schema = `+schema+` AND table_name = ?
+		ORDER BY ordinal_position`, args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var c Column
+		var nullable string
+		if err := rows.Scan(&c.Name, &c.Type, &nullable); err != nil {
+			rows.Close()
+			return err
+		}
+		c.Type = strings.ToLower(c.Type)
+		c.Nullable = nullable == "YES"
+		t.Columns = append(t.Columns, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = sess.Query(`SELECT kcu.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+			ON kcu.constraint_schema = tc.constraint_schema
+			AND kcu.constraint_name = tc.constraint_name
+			AND kcu.table_name = tc.table_name
+		WHERE tc.constraint_type = 'PRIMARY KEY'
+			AND tc.table_schema = `+schema+` AND tc.table_name = ?
+		ORDER BY kcu.ordinal_position`, args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			rows.Close()
+			return err
+		}
+		t.PrimaryKey = append(t.PrimaryKey, column)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var query string
+	if d == dialectMySQL {
+		query = `SELECT constraint_name, column_name, referenced_table_name, referenced_column_name
+			FROM information_schema.key_column_usage
+			WHERE table_schema = ` + schema + ` AND table_name = ?
+				AND referenced_table_name IS NOT NULL
+			ORDER BY constraint_name, ordinal_position`
+	} else {
+		query = `SELECT kcu.constraint_name, kcu.column_name, ref.table_name, ref.column_name
+			FROM information_schema.referential_constraints rc
+			JOIN information_schema.key_column_usage kcu
+				ON kcu.constraint_schema = rc.constraint_schema
+				AND kcu.constraint_name = rc.constraint_name
+			JOIN information_schema.key_column_usage ref
+				ON ref.constraint_schema = rc.unique_constraint_schema
+				AND ref.constraint_name = rc.unique_constraint_name
+				AND ref.ordinal_position = kcu.position_in_unique_constraint
+			WHERE kcu.table_schema = ` + schema + ` AND kcu.table_name = ?
+			ORDER BY kcu.constraint_name, kcu.ordinal_position`
+	}
+
+	rows, err = sess.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, column, refTable, refColumn string
+		if err := rows.Scan(&name, &column, &refTable, &refColumn); err != nil {
+			return err
+		}
+		t.addForeignKey(name, column, refTable, refColumn)
+	}
+	return rows.Err()
+}
+
+func describeSQLite(sess Session, t *Table) error {
+	rows, err := sess.Query(fmt.Sprintf("PRAGMA table_info(%s)", quoteIdent(dialectSQLite, t.Name)))
+	if err != nil {
+		return err
+	}
+
+	var pKeys []string
+	var pKeyPos []int
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			c                Column
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &c.Name, &c.Type, &notNull, &defaultValue, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		c.Type = strings.ToLower(c.Type)
+		c.Nullable = notNull == 0 && pk == 0
+		t.Columns = append(t.Columns, c)
+		if pk > 0 {
+			pKeys = append(pKeys, c.Name)
+			pKeyPos = append(pKeyPos, pk)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// pk is the position of the column within the primary key.
+	t.PrimaryKey = make([]string, len(pKeys))
+	for i, pos := range pKeyPos {
+		t.PrimaryKey[pos-1] = pKeys[i]
+	}
+
+	rows, err = sess.Query(fmt.Sprintf("PRAGMA foreign_key_list(%s)", quoteIdent(dialectSQLite, t.Name)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id, seq                                   int
+			refTable, column, onUpdate, onDelete, mtc string
+			refColumn                                 sql.NullString
+		)
+		if err := rows.Scan(&id, &seq, &refTable, &column, &refColumn, &onUpdate, &onDelete, &mtc); err != nil {
+			return err
+		}
+		// Foreign keys that reference the primary key may omit the column.
+		ref := refColumn.String
+		if !refColumn.Valid {
+			ref = "id"
+		}
+		t.addForeignKey(fmt.Sprintf("fk_%s_%d", t.Name, id), column, refTable, ref)
+	}
+	return rows.Err()
+}
+
+func (t *Table) addForeignKey(name, column, refTable, refColumn string) {
+	for i := range t.ForeignKeys {
+		if t.ForeignKeys[i].Name == name {
+			t.ForeignKeys[i].Columns = append(t.ForeignKeys[i].Columns, column)
+			t.ForeignKeys[i].RefColumns = append(t.ForeignKeys[i].RefColumns, refColumn)
+			return
+		}
+	}
+	t.ForeignKeys = append(t.ForeignKeys, ForeignKey{
+		Name:       name,
+		Columns:    []string{column},
+		RefTable:   refTable,
+		RefColumns: []string{refColumn},
+	})
+}
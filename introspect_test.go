@@ -0,0 +1,39 @@
+package bond_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+)
+
+func TestDescribe(t *testing.T) {
+	tables, err := bond.Describe(DB, "accounts", "users")
+	assert.NoError(t, err)
+	if !assert.Len(t, tables, 2) {
+		return
+	}
+
+	accounts := tables[0]
+	assert.Equal(t, "accounts", accounts.Name)
+	assert.Equal(t, []string{"id"}, accounts.PrimaryKey)
+	if assert.Len(t, accounts.Columns, 4) {
+		assert.Equal(t, "id", accounts.Columns[0].Name)
+		assert.Equal(t, "integer", accounts.Columns[0].Type)
+		assert.False(t, accounts.Columns[0].Nullable)
+		assert.Equal(t, "character varying", accounts.Column("name").Type)
+		assert.True(t, accounts.Column("name").Nullable)
+	}
+	assert.Nil(t, accounts.Column("missing"))
+
+	all, err := bond.Describe(DB)
+	assert.NoError(t, err)
+	names := make([]string, 0, len(all))
+	for _, table := range all {
+		names = append(names, table.Name)
+	}
+	assert.Contains(t, names, "logs")
+
+	_, err = bond.Describe(DB, "missing")
+	assert.Error(t, err)
+}
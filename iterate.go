@@ -0,0 +1,84 @@
+package bond
+
+import (
+	"reflect"
+
+	"upper.io/db.v3"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Iterate streams the items matching cond, one row at a time, to fn. fn must
+// be a func(*T) error where T is the model of the store, e.g.:
+//
+//	err := sess.Store("accounts").Iterate(db.Cond{"disabled": false}, func(a *Account) error {
+//		return notify(a)
+//	})
+//
+// Every item is a new value, AfterFind hooks run before it's passed to fn. A
+// nil cond matches every item. Iteration stops with the first error returned
+// by fn or by a hook, or when the session's context is done, and the cursor
+// is closed when Iterate returns.
+func (s *store) Iterate(cond interface{}, fn interface{}) error {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func || ft.NumIn() != 1 || ft.NumOut() != 1 ||
+		ft.In(0).Kind() != reflect.Ptr || ft.In(0).Elem().Kind() != reflect.Struct ||
+		ft.Out(0) != errorType {
+		return ErrExpectingIterateFunc
+	}
+
+	itemType := ft.In(0).Elem()
+	return s.iterate(cond, func() interface{} {
+		return reflect.New(itemType).Interface()
+	}, func(item interface{}) error {
+		out := fv.Call([]reflect.Value{reflect.ValueOf(item)})
+		if err, _ := out[0].Interface().(error); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// iterate fetches every row matching cond into a new item and passes it to
+// fn.
+func (s *store) iterate(cond interface{}, newItem func() interface{}, fn func(item interface{}) error) error {
+	if s.Collection == nil {
+		return ErrInvalidCollection
+	}
+
+	var res db.Result
+	if cond == nil {
+		res = s.Find()
+	} else {
+		res = s.Find(cond)
+	}
+	defer res.Close()
+
+	ctx := s.session.Context()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		item := newItem()
+		if !res.Next(item) {
+			break
+		}
+
+		if m, ok := item.(HasAfterFind); ok {
+			if err := s.runHook("AfterFind", item, m.AfterFind); err != nil {
+				return err
+			}
+		}
+
+		if im := s.identities(); im != nil {
+			item = im.resolve(s, reflect.ValueOf(item)).Interface()
+		}
+
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return res.Err()
+}
@@ -0,0 +1,36 @@
+//go:build go1.23
+
+package bond
+
+import (
+	"errors"
+	"iter"
+)
+
+var errStopIteration = errors.New("stop iteration")
+
+// Iter returns an iterator over the items of store matching cond, see
+// Store.Iterate, T must be a struct. An error ends the iteration and is
+// yielded with a nil item:
+//
+//	for account, err := range bond.Iter[Account](sess.Store("accounts"), nil) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// Breaking out of the loop closes the cursor.
+func Iter[T any](store Store, cond interface{}) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		err := store.Iterate(cond, func(item *T) error {
+			if !yield(item, nil) {
+				return errStopIteration
+			}
+			return nil
+		})
+		if err != nil && err != errStopIteration {
+			yield(nil, err)
+		}
+	}
+}
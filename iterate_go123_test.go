@@ -0,0 +1,32 @@
+//go:build go1.23
+
+package bond_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+)
+
+func TestIter(t *testing.T) {
+	dbReset()
+
+	for _, message := range []string{"one", "two", "three"} {
+		assert.NoError(t, DB.Save(&Log{Message: message}))
+	}
+
+	count := 0
+	for l, err := range bond.Iter[FoundLog](DB.Log, nil) {
+		assert.NoError(t, err)
+		assert.True(t, l.found)
+		count++
+	}
+	assert.Equal(t, 3, count)
+
+	for l, err := range bond.Iter[FoundLog](DB.Log, nil) {
+		assert.NoError(t, err)
+		assert.NotEmpty(t, l.Message)
+		break
+	}
+}
@@ -0,0 +1,59 @@
+package bond_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/db.v3"
+)
+
+type FoundLog struct {
+	ID      int64  `db:"id,omitempty"`
+	Message string `db:"message"`
+
+	found bool
+}
+
+func (l *FoundLog) AfterFind(sess bond.Session) error {
+	l.found = true
+	return nil
+}
+
+func TestIterate(t *testing.T) {
+	dbReset()
+
+	for _, message := range []string{"one", "two", "three"} {
+		assert.NoError(t, DB.Save(&Log{Message: message}))
+	}
+
+	var messages []string
+	err := DB.Log.Iterate(db.Cond{"message <>": "two"}, func(l *FoundLog) error {
+		assert.True(t, l.found)
+		messages = append(messages, l.Message)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"one", "three"}, messages)
+
+	stop := errors.New("stop")
+	count := 0
+	err = DB.Log.Iterate(nil, func(l *FoundLog) error {
+		count++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, count)
+
+	err = DB.Log.Iterate(nil, func(l FoundLog) error { return nil })
+	assert.Equal(t, bond.ErrExpectingIterateFunc, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = DB.WithContext(ctx).Store("logs").Iterate(nil, func(l *FoundLog) error {
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+}
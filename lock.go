@@ -0,0 +1,86 @@
+package bond
+
+import (
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+// LockMode is the row-level lock taken by FindLocked.
+type LockMode string
+
+// Lock modes, FOR NO KEY UPDATE and FOR KEY SHARE are PostgreSQL only.
+const (
+	ForUpdate      LockMode = "FOR UPDATE"
+	ForNoKeyUpdate LockMode = "FOR NO KEY UPDATE"
+	ForShare       LockMode = "FOR SHARE"
+	ForKeyShare    LockMode = "FOR KEY SHARE"
+)
+
+// NoWait returns the lock mode that fails right away, instead of waiting,
+// when a row is locked by another transaction.
+func (m LockMode) NoWait() LockMode {
+	return m + " NOWAIT"
+}
+
+// SkipLocked returns the lock mode that skips the rows locked by other
+// transactions, e.g. to claim jobs from a queue.
+func (m LockMode) SkipLocked() LockMode {
+	return m + " SKIP LOCKED"
+}
+
+type hasTx interface {
+	inTx() bool
+}
+
+func (s *session) inTx() bool {
+	_, ok := s.Backend.(sqlbuilder.Tx)
+	return ok
+}
+
+// FindForUpdate is FindLocked(ForUpdate, conds...).
+func (s *store) FindForUpdate(conds ...interface{}) (sqlbuilder.Selector, error) {
+	return s.FindLocked(ForUpdate, conds...)
+}
+
+// FindLocked returns a query on the items matching conds, and the store's
+// tenant and scopes, that locks the rows it reads until the end of the
+// transaction:
+//
+//	jobs, err := tx.Store("jobs").FindLocked(bond.ForUpdate.SkipLocked(), db.Cond{"status": "pending"})
+//	if err != nil {
+//		return err
+//	}
+//	err = jobs.OrderBy("id").Limit(10).All(&claimed)
+//
+// Locks only make sense within a transaction, FindLocked fails with
+// ErrNotInTx on sessions that aren't transactions.
+func (s *store) FindLocked(mode LockMode, conds ...interface{}) (sqlbuilder.Selector, error) {
+	if s.Collection == nil {
+		return nil, ErrInvalidCollection
+	}
+	if tx, ok := s.session.(hasTx); !ok || !tx.inTx() {
+		return nil, ErrNotInTx
+	}
+
+	conds = conds[:len(conds):len(conds)]
+	tenantCond, err := s.tenantCond()
+	if err != nil {
+		return nil, err
+	}
+	if tenantCond != nil {
+		conds = append(conds, tenantCond)
+	}
+	scopeConds, err := s.scopeConds()
+	if err != nil {
+		return nil, err
+	}
+	conds = append(conds, scopeConds...)
+
+	sel := s.session.SelectFrom(s.Collection.Name())
+	if len(conds) > 0 {
+		sel = sel.Where(conds...)
+	}
+	// The lock clause comes last, after ORDER BY, LIMIT and OFFSET.
+	return sel.Amend(func(query string) string {
+		return query + " " + string(mode)
+	}), nil
+}
@@ -0,0 +1,47 @@
+package bond_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/db.v3"
+)
+
+func TestFindLocked(t *testing.T) {
+	dbReset()
+
+	for _, message := range []string{"one", "two", "three"} {
+		assert.NoError(t, DB.Save(&Log{Message: message}))
+	}
+
+	_, err := DB.Log.FindForUpdate(db.Cond{"message": "one"})
+	assert.Equal(t, bond.ErrNotInTx, err)
+
+	tx, err := DB.NewSessionTx(nil)
+	assert.NoError(t, err)
+	defer tx.TxRollback()
+
+	sel, err := tx.Store("logs").FindForUpdate(db.Cond{"message": "one"})
+	assert.NoError(t, err)
+	assert.Contains(t, sel.String(), "FOR UPDATE")
+
+	var locked Log
+	assert.NoError(t, sel.One(&locked))
+	assert.Equal(t, "one", locked.Message)
+
+	// Another transaction skips the locked row, or fails right away.
+	other, err := DB.NewSessionTx(nil)
+	assert.NoError(t, err)
+	defer other.TxRollback()
+
+	sel, err = other.Store("logs").FindLocked(bond.ForUpdate.SkipLocked())
+	assert.NoError(t, err)
+	var logs []Log
+	assert.NoError(t, sel.OrderBy("id").All(&logs))
+	assert.Len(t, logs, 2)
+
+	sel, err = other.Store("logs").FindLocked(bond.ForShare.NoWait(), db.Cond{"id": locked.ID})
+	assert.NoError(t, err)
+	assert.Error(t, sel.One(&locked))
+}
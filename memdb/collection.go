@@ -0,0 +1,488 @@
+package memdb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"upper.io/db.v3"
+	"upper.io/db.v3/lib/reflectx"
+)
+
+// row maps column names to values.
+type row map[string]interface{}
+
+func (r row) clone() row {
+	c := make(row, len(r))
+	for k, v := range r {
+		c[k] = v
+	}
+	return c
+}
+
+type table struct {
+	pKeys []string
+	rows  map[string]row
+	keys  []string // keys of rows, in insertion order
+
+	// seq is shared by the table and its snapshots, like SQL sequences IDs
+	// aren't reused when a transaction is rolled back.
+	seq *int64
+
+	// base holds the rows of a snapshot as they were before the transaction
+	// changed them, nil for rows the transaction inserted.
+	base map[string]row
+}
+
+func newTable(pKeys []string) *table {
+	return &table{
+		pKeys: pKeys,
+		rows:  make(map[string]row),
+		seq:   new(int64),
+	}
+}
+
+// snapshot returns a copy of the table for a transaction.
+func (t *table) snapshot() *table {
+	c := &table{
+		pKeys: t.pKeys,
+		rows:  make(map[string]row, len(t.rows)),
+		keys:  make([]string, len(t.keys)),
+		seq:   t.seq,
+		base:  make(map[string]row),
+	}
+	copy(c.keys, t.keys)
+	for k, r := range t.rows {
+		c.rows[k] = r.clone()
+	}
+	return c
+}
+
+// key returns the primary key of r. Values are keyed by type so that, as in
+// SQL, the integer 1 and the string "1" are different keys.
+func (t *table) key(r row) string {
+	parts := make([]string, len(t.pKeys))
+	for i, pKey := range t.pKeys {
+		v := normalize(r[pKey])
+		parts[i] = fmt.Sprintf("%T:%v", v, v)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// track records the row with key k as it was before the transaction changed
+// it.
+func (t *table) track(k string) {
+	if t.base == nil {
+		return
+	}
+	if _, ok := t.base[k]; !ok {
+		t.base[k] = t.rows[k]
+	}
+}
+
+func (t *table) insert(r row) (string, error) {
+	if len(t.pKeys) == 1 {
+		pKey := t.pKeys[0]
+		if isZero(r[pKey]) {
+			r[pKey] = atomic.AddInt64(t.seq, 1)
+		} else if n, ok := normalize(r[pKey]).(int64); ok {
+			for seq := atomic.LoadInt64(t.seq); n > seq; seq = atomic.LoadInt64(t.seq) {
+				if atomic.CompareAndSwapInt64(t.seq, seq, n) {
+					break
+				}
+			}
+		}
+	}
+
+	k := t.key(r)
+	if _, ok := t.rows[k]; ok {
+		return "", fmt.Errorf("memdb: duplicate primary key %q", k)
+	}
+
+	t.track(k)
+	t.rows[k] = r
+	t.keys = append(t.keys, k)
+	return k, nil
+}
+
+// replace stores r in place of the row with key k.
+func (t *table) replace(k string, r row) error {
+	newKey := t.key(r)
+	if newKey != k {
+		if _, ok := t.rows[newKey]; ok {
+			return fmt.Errorf("memdb: duplicate primary key %q", newKey)
+		}
+		t.track(k)
+		t.track(newKey)
+		delete(t.rows, k)
+		for i := range t.keys {
+			if t.keys[i] == k {
+				t.keys[i] = newKey
+				break
+			}
+		}
+	}
+	t.track(newKey)
+	t.rows[newKey] = r
+	return nil
+}
+
+// put stores r with key k, appending it if the table has no such row.
+func (t *table) put(k string, r row) {
+	if _, ok := t.rows[k]; !ok {
+		t.keys = append(t.keys, k)
+	}
+	t.rows[k] = r
+}
+
+func (t *table) delete(k string) {
+	if _, ok := t.rows[k]; !ok {
+		return
+	}
+	t.track(k)
+	delete(t.rows, k)
+	for i := range t.keys {
+		if t.keys[i] == k {
+			t.keys = append(t.keys[:i], t.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (t *table) truncate() {
+	for _, k := range t.keys {
+		t.track(k)
+	}
+	t.rows = make(map[string]row)
+	t.keys = nil
+}
+
+type collection struct {
+	*engine
+
+	name string
+}
+
+var _ db.Collection = &collection{}
+
+func (c *collection) Name() string {
+	return c.name
+}
+
+// PrimaryKeys returns the primary keys of the collection, as declared in the
+// schema.
+func (c *collection) PrimaryKeys() []string {
+	return c.schema[c.name]
+}
+
+func (c *collection) Exists() bool {
+	_, ok := c.schema[c.name]
+	return ok
+}
+
+// withTable runs fn with the collection's table, the state is locked for
+// writing when write is true.
+func (c *collection) withTable(write bool, fn func(t *table) error) error {
+	if err := c.checkTx(); err != nil {
+		return err
+	}
+
+	if write {
+		c.state.mu.Lock()
+		defer c.state.mu.Unlock()
+	} else {
+		c.state.mu.RLock()
+		defer c.state.mu.RUnlock()
+	}
+
+	t, ok := c.state.tables[c.name]
+	if !ok {
+		return db.ErrCollectionDoesNotExist
+	}
+	return fn(t)
+}
+
+func (c *collection) Insert(item interface{}) (interface{}, error) {
+	r, err := toRow(item)
+	if err != nil {
+		return nil, err
+	}
+
+	var id interface{}
+	err = c.withTable(true, func(t *table) error {
+		if _, err := t.insert(r); err != nil {
+			return err
+		}
+		id = primaryKeyValue(t, r)
+		return nil
+	})
+	return id, err
+}
+
+func (c *collection) InsertReturning(item interface{}) error {
+	if reflect.TypeOf(item).Kind() != reflect.Ptr {
+		return ErrExpectingPointer
+	}
+
+	r, err := toRow(item)
+	if err != nil {
+		return err
+	}
+
+	err = c.withTable(true, func(t *table) error {
+		_, err := t.insert(r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return fromRow(r.clone(), item)
+}
+
+func (c *collection) UpdateReturning(item interface{}) error {
+	if reflect.TypeOf(item).Kind() != reflect.Ptr {
+		return ErrExpectingPointer
+	}
+
+	r, err := toRow(item)
+	if err != nil {
+		return err
+	}
+
+	var updated row
+	err = c.withTable(true, func(t *table) error {
+		k := t.key(r)
+		current, ok := t.rows[k]
+		if !ok {
+			return db.ErrNoMoreRows
+		}
+		updated = current.clone()
+		for col, v := range r {
+			updated[col] = v
+		}
+		return t.replace(k, updated)
+	})
+	if err != nil {
+		return err
+	}
+	return fromRow(updated.clone(), item)
+}
+
+func (c *collection) Find(conds ...interface{}) db.Result {
+	return &result{c: c, conds: conds}
+}
+
+func (c *collection) Truncate() error {
+	return c.withTable(true, func(t *table) error {
+		t.truncate()
+		return nil
+	})
+}
+
+func primaryKeyValue(t *table, r row) interface{} {
+	if len(t.pKeys) == 1 {
+		return r[t.pKeys[0]]
+	}
+	values := make([]interface{}, len(t.pKeys))
+	for i, pKey := range t.pKeys {
+		values[i] = r[pKey]
+	}
+	return values
+}
+
+var mapper = reflectx.NewMapper("db")
+
+// structFields returns the fields of t that are mapped to columns, the same
+// way bond and upper.io/db map them: fields of structs that are embedded
+// without a name or tagged inline are columns of t.
+func structFields(t reflect.Type) []*reflectx.FieldInfo {
+	var fields []*reflectx.FieldInfo
+next:
+	for _, fi := range mapper.TypeMap(t).Index {
+		if fi.Name == "" || inlined(fi) {
+			continue
+		}
+		for p := fi.Parent; p.Parent != nil; p = p.Parent {
+			if !inlined(p) {
+				continue next
+			}
+		}
+		fields = append(fields, fi)
+	}
+	return fields
+}
+
+func inlined(fi *reflectx.FieldInfo) bool {
+	if reflectx.Deref(fi.Field.Type).Kind() != reflect.Struct {
+		return false
+	}
+	_, inline := fi.Options["inline"]
+	return inline || (fi.Embedded && fi.Field.Tag.Get("db") == "")
+}
+
+// fieldByIndex returns the field of v at index, or an invalid value if it is
+// within a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+// toRow converts a struct or a map into a row.
+func toRow(item interface{}) (row, error) {
+	v := reflect.ValueOf(item)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, ErrExpectingPointer
+		}
+		v = v.Elem()
+	}
+
+	r := make(row)
+	switch v.Kind() {
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			r[fmt.Sprintf("%v", k.Interface())] = toValue(v.MapIndex(k))
+		}
+	case reflect.Struct:
+		for _, fi := range structFields(v.Type()) {
+			fv := fieldByIndex(v, fi.Index)
+			if !fv.IsValid() {
+				continue
+			}
+			if _, omitempty := fi.Options["omitempty"]; omitempty && fv.IsZero() {
+				continue
+			}
+			r[fi.Name] = toValue(fv)
+		}
+	default:
+		return nil, ErrExpectingPointer
+	}
+	return r, nil
+}
+
+// toValue returns the value that is stored for v.
+func toValue(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	if valuer, ok := v.Interface().(driver.Valuer); ok {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil
+		}
+		value, err := valuer.Value()
+		if err != nil {
+			return nil
+		}
+		return value
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		return toValue(v.Elem())
+	}
+	return v.Interface()
+}
+
+// fromRow copies the values of r into dest, which must be a pointer to a
+// struct or to a map.
+func fromRow(r row, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return ErrExpectingPointer
+	}
+	return assignRow(r, v.Elem())
+}
+
+func assignRow(r row, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assignRow(r, v.Elem())
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for col, value := range r {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := assign(elem, value); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(col).Convert(v.Type().Key()), elem)
+		}
+		return nil
+	case reflect.Struct:
+		for _, fi := range structFields(v.Type()) {
+			value, ok := r[fi.Name]
+			if !ok {
+				continue
+			}
+			if err := assign(reflectx.FieldByIndexes(v, fi.Index), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return ErrExpectingPointer
+}
+
+// assign sets dest to value.
+func assign(dest reflect.Value, value interface{}) error {
+	if dest.CanAddr() {
+		if scanner, ok := dest.Addr().Interface().(sql.Scanner); ok {
+			return scanner.Scan(value)
+		}
+	}
+
+	if value == nil {
+		dest.Set(reflect.Zero(dest.Type()))
+		return nil
+	}
+
+	if dest.Kind() == reflect.Ptr {
+		elem := reflect.New(dest.Type().Elem())
+		if err := assign(elem.Elem(), value); err != nil {
+			return err
+		}
+		dest.Set(elem)
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Type().AssignableTo(dest.Type()) {
+		dest.Set(v)
+		return nil
+	}
+	if kindOf(v.Kind()) == kindOf(dest.Kind()) && v.Type().ConvertibleTo(dest.Type()) {
+		dest.Set(v.Convert(dest.Type()))
+		return nil
+	}
+	return fmt.Errorf("memdb: cannot assign %T to %v", value, dest.Type())
+}
+
+// kindOf groups kinds that can be converted into each other safely.
+func kindOf(k reflect.Kind) reflect.Kind {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return reflect.Float64
+	}
+	return k
+}
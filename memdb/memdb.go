@@ -0,0 +1,359 @@
+// Package memdb provides an in-memory bond backend for unit tests.
+//
+// Collections are kept in memory as maps of rows keyed by primary key, result
+// sets support db.Cond filtering, ordering, limits and offsets and
+// transactions can be committed or rolled back. Commits fail with ErrConflict
+// when another transaction wrote the same rows first. The Update and
+// DeleteFrom builders support db.Cond conditions, raw SQL and the other
+// builders fail with ErrSQLNotSupported.
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"upper.io/bond"
+	"upper.io/db.v3"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+// Schema maps collection names to their primary keys. A collection with a
+// single primary key gets a sequential integer ID when an item is created
+// without one.
+type Schema map[string][]string
+
+// New returns a bond session on a new in-memory database with the given
+// schema.
+func New(schema Schema) bond.Session {
+	return bond.New(NewDatabase(schema))
+}
+
+type state struct {
+	mu     sync.RWMutex
+	tables map[string]*table
+}
+
+// engine implements everything databases and transactions have in common.
+type engine struct {
+	schema    Schema
+	state     *state
+	ctx       context.Context
+	txOptions *sql.TxOptions
+	tx        *txState
+
+	*settings
+}
+
+// Database is an in-memory database, it satisfies bond.Backend and
+// sqlbuilder.Database.
+type Database struct {
+	*engine
+}
+
+var _ sqlbuilder.Database = &Database{}
+
+// NewDatabase returns a new in-memory database with the given schema.
+func NewDatabase(schema Schema) *Database {
+	tables := make(map[string]*table, len(schema))
+	for name, pKeys := range schema {
+		tables[name] = newTable(pKeys)
+	}
+	return &Database{
+		engine: &engine{
+			schema:   schema,
+			state:    &state{tables: tables},
+			ctx:      context.Background(),
+			settings: &settings{},
+		},
+	}
+}
+
+// WithContext returns a copy of the database that carries the given context.
+func (d *Database) WithContext(ctx context.Context) sqlbuilder.Database {
+	e := *d.engine
+	e.ctx = ctx
+	return &Database{engine: &e}
+}
+
+// ErrConflict is returned by Commit when a row written by the transaction was
+// changed by another transaction since the transaction started, the
+// transaction is rolled back.
+var ErrConflict = errors.New("memdb: could not serialize access due to concurrent update")
+
+// NewTx starts a transaction, the transaction works on a snapshot of the
+// database and its changes are applied to the database's rows on commit.
+func (d *Database) NewTx(ctx context.Context) (sqlbuilder.Tx, error) {
+	if ctx == nil {
+		ctx = d.ctx
+	}
+
+	d.state.mu.RLock()
+	defer d.state.mu.RUnlock()
+
+	tables := make(map[string]*table, len(d.state.tables))
+	for name := range d.state.tables {
+		tables[name] = d.state.tables[name].snapshot()
+	}
+
+	e := *d.engine
+	e.ctx = ctx
+	e.state = &state{tables: tables}
+	e.tx = &txState{parent: d.state}
+	return &Tx{engine: &e}, nil
+}
+
+// Tx runs fn within a transaction, the transaction is rolled back if fn
+// returns an error or panics and committed otherwise.
+func (d *Database) Tx(ctx context.Context, fn func(sess sqlbuilder.Tx) error) error {
+	tx, err := d.NewTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rErr := tx.Rollback(); rErr != nil {
+			return rErr
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// Tx is a transaction on an in-memory database.
+type Tx struct {
+	*engine
+}
+
+type txState struct {
+	parent *state
+	done   bool
+	mu     sync.Mutex
+}
+
+var _ sqlbuilder.Tx = &Tx{}
+
+// WithContext returns a copy of the transaction that carries the given
+// context.
+func (t *Tx) WithContext(ctx context.Context) sqlbuilder.Tx {
+	e := *t.engine
+	e.ctx = ctx
+	return &Tx{engine: &e}
+}
+
+// Commit applies the rows written by the transaction to the database, it fails
+// with ErrConflict if any of them was changed since the transaction started.
+func (t *Tx) Commit() error {
+	t.tx.mu.Lock()
+	defer t.tx.mu.Unlock()
+
+	if t.tx.done {
+		return sql.ErrTxDone
+	}
+	t.tx.done = true
+
+	t.state.mu.RLock()
+	defer t.state.mu.RUnlock()
+
+	t.tx.parent.mu.Lock()
+	defer t.tx.parent.mu.Unlock()
+
+	for name, tbl := range t.state.tables {
+		parent := t.tx.parent.tables[name]
+		for k, r := range tbl.base {
+			if !reflect.DeepEqual(parent.rows[k], r) {
+				return ErrConflict
+			}
+		}
+	}
+
+	for name, tbl := range t.state.tables {
+		parent := t.tx.parent.tables[name]
+		for k := range tbl.base {
+			if _, ok := tbl.rows[k]; !ok {
+				parent.delete(k)
+			}
+		}
+		for _, k := range tbl.keys {
+			if _, ok := tbl.base[k]; ok {
+				parent.put(k, tbl.rows[k].clone())
+			}
+		}
+	}
+	return nil
+}
+
+// Rollback discards the transaction.
+func (t *Tx) Rollback() error {
+	t.tx.mu.Lock()
+	defer t.tx.mu.Unlock()
+
+	if t.tx.done {
+		return sql.ErrTxDone
+	}
+	t.tx.done = true
+	return nil
+}
+
+// checkTx returns sql.ErrTxDone if the engine belongs to a transaction that
+// was already committed or rolled back.
+func (e *engine) checkTx() error {
+	if e.tx == nil {
+		return nil
+	}
+	e.tx.mu.Lock()
+	defer e.tx.mu.Unlock()
+	if e.tx.done {
+		return sql.ErrTxDone
+	}
+	return nil
+}
+
+func (e *engine) Driver() interface{} {
+	return nil
+}
+
+func (e *engine) Open(db.ConnectionURL) error {
+	return nil
+}
+
+func (e *engine) Ping() error {
+	return nil
+}
+
+func (e *engine) Close() error {
+	return nil
+}
+
+func (e *engine) Name() string {
+	return "memdb"
+}
+
+func (e *engine) ConnectionURL() db.ConnectionURL {
+	return nil
+}
+
+func (e *engine) ClearCache() {
+}
+
+func (e *engine) Context() context.Context {
+	return e.ctx
+}
+
+func (e *engine) SetTxOptions(txOptions sql.TxOptions) {
+	e.txOptions = &txOptions
+}
+
+func (e *engine) TxOptions() *sql.TxOptions {
+	return e.txOptions
+}
+
+// Collection returns the collection with the given name.
+func (e *engine) Collection(name string) db.Collection {
+	return &collection{engine: e, name: name}
+}
+
+// Collections returns the names of all collections in the schema.
+func (e *engine) Collections() ([]string, error) {
+	names := make([]string, 0, len(e.schema))
+	for name := range e.schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+type settings struct {
+	mu sync.RWMutex
+
+	logging         bool
+	logger          db.Logger
+	preparedCache   bool
+	connMaxLifetime time.Duration
+	maxIdleConns    int
+	maxOpenConns    int
+}
+
+func (s *settings) SetLogging(value bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logging = value
+}
+
+func (s *settings) LoggingEnabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.logging
+}
+
+func (s *settings) SetLogger(logger db.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logger = logger
+}
+
+func (s *settings) Logger() db.Logger {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.logger
+}
+
+func (s *settings) SetPreparedStatementCache(value bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.preparedCache = value
+}
+
+func (s *settings) PreparedStatementCacheEnabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.preparedCache
+}
+
+func (s *settings) SetConnMaxLifetime(t time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connMaxLifetime = t
+}
+
+func (s *settings) ConnMaxLifetime() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.connMaxLifetime
+}
+
+func (s *settings) SetMaxIdleConns(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxIdleConns = n
+}
+
+func (s *settings) MaxIdleConns() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.maxIdleConns
+}
+
+func (s *settings) SetMaxOpenConns(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxOpenConns = n
+}
+
+func (s *settings) MaxOpenConns() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.maxOpenConns
+}
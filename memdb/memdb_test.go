@@ -0,0 +1,320 @@
+package memdb_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/bond/memdb"
+	"upper.io/db.v3"
+)
+
+type Account struct {
+	ID       int64  `db:"id,omitempty"`
+	Name     string `db:"name"`
+	Disabled bool   `db:"disabled"`
+}
+
+func (a *Account) Store(sess bond.Session) bond.Store {
+	return sess.Store("accounts")
+}
+
+type Membership struct {
+	AccountID int64  `db:"account_id"`
+	UserID    int64  `db:"user_id"`
+	Role      string `db:"role"`
+}
+
+func (m *Membership) Store(sess bond.Session) bond.Store {
+	return sess.Store("memberships")
+}
+
+func newSession() bond.Session {
+	return memdb.New(memdb.Schema{
+		"accounts":    {"id"},
+		"memberships": {"account_id", "user_id"},
+	})
+}
+
+func TestStore(t *testing.T) {
+	sess := newSession()
+
+	acct := &Account{Name: "Pressly"}
+	err := sess.Save(acct)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), acct.ID)
+
+	var acctChk *Account
+	err = sess.Store("accounts").Find(db.Cond{"id": acct.ID}).One(&acctChk)
+	assert.NoError(t, err)
+	assert.Equal(t, acct.Name, acctChk.Name)
+
+	acct.Disabled = true
+	err = sess.Save(acct)
+	assert.NoError(t, err)
+
+	count, err := sess.Store("accounts").Find(db.Cond{"disabled": true}).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+
+	err = sess.Delete(acct)
+	assert.NoError(t, err)
+
+	err = sess.Store("accounts").Find(acct.ID).One(&acctChk)
+	assert.Equal(t, db.ErrNoMoreRows, err)
+}
+
+func TestCompositePrimaryKey(t *testing.T) {
+	sess := newSession()
+
+	memberships := sess.Store("memberships")
+
+	// Items with a non-zero primary key are updated by Save, so they must be
+	// created explicitly.
+	err := memberships.Create(&Membership{AccountID: 1, UserID: 2, Role: "owner"})
+	assert.NoError(t, err)
+
+	err = memberships.Create(&Membership{AccountID: 1, UserID: 2})
+	assert.Error(t, err)
+
+	err = sess.Save(&Membership{AccountID: 1, UserID: 2, Role: "admin"})
+	assert.NoError(t, err)
+
+	var m Membership
+	err = memberships.Find(db.Cond{"account_id": 1, "user_id": 2}).One(&m)
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", m.Role)
+}
+
+func TestQueries(t *testing.T) {
+	sess := newSession()
+	accounts := sess.Store("accounts")
+
+	for _, name := range []string{"Apple", "Google", "Microsoft", "Amazon", "Netflix"} {
+		err := accounts.Save(&Account{Name: name, Disabled: name == "Google"})
+		assert.NoError(t, err)
+	}
+
+	var names []struct {
+		Name string `db:"name"`
+	}
+	err := accounts.Find(db.Cond{"name LIKE": "A%"}).OrderBy("-name").All(&names)
+	assert.NoError(t, err)
+	if assert.Len(t, names, 2) {
+		assert.Equal(t, "Apple", names[0].Name)
+		assert.Equal(t, "Amazon", names[1].Name)
+	}
+
+	var accts []*Account
+	err = accounts.Find(db.Cond{"id >": 1}).OrderBy("name").Limit(2).Offset(1).All(&accts)
+	assert.NoError(t, err)
+	if assert.Len(t, accts, 2) {
+		assert.Equal(t, "Google", accts[0].Name)
+		assert.Equal(t, "Microsoft", accts[1].Name)
+	}
+
+	count, err := accounts.Find(db.Or(
+		db.Cond{"id IN": []int64{1, 2}},
+		db.Cond{"name": db.NotEq("Microsoft"), "disabled": false},
+	)).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), count)
+
+	err = accounts.Find(db.Cond{"disabled": true}).Update(map[string]interface{}{"disabled": false})
+	assert.NoError(t, err)
+
+	err = accounts.Find(db.Cond{"name": "Netflix"}).Delete()
+	assert.NoError(t, err)
+
+	res := accounts.Find(db.Cond{"disabled": false}).OrderBy("id")
+	defer res.Close()
+
+	var acct Account
+	seen := 0
+	for res.Next(&acct) {
+		seen++
+	}
+	assert.NoError(t, res.Err())
+	assert.Equal(t, 4, seen)
+}
+
+func TestTransactions(t *testing.T) {
+	sess := newSession()
+
+	err := sess.SessionTx(nil, func(tx bond.Session) error {
+		if err := tx.Save(&Account{Name: "Rolled back"}); err != nil {
+			return err
+		}
+		return errors.New("rolling back")
+	})
+	assert.Error(t, err)
+
+	err = sess.SessionTx(nil, func(tx bond.Session) error {
+		return tx.Save(&Account{Name: "Committed"})
+	})
+	assert.NoError(t, err)
+
+	tx, err := sess.NewSessionTx(nil)
+	assert.NoError(t, err)
+
+	err = tx.Save(&Account{Name: "Pending"})
+	assert.NoError(t, err)
+
+	count, err := sess.Store("accounts").Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+
+	err = tx.TxCommit()
+	assert.NoError(t, err)
+
+	var accts []Account
+	err = sess.Store("accounts").Find().OrderBy("id").All(&accts)
+	assert.NoError(t, err)
+	if assert.Len(t, accts, 2) {
+		assert.Equal(t, "Committed", accts[0].Name)
+		assert.Equal(t, "Pending", accts[1].Name)
+	}
+}
+
+func TestConcurrentTransactions(t *testing.T) {
+	sess := newSession()
+
+	acct := &Account{Name: "Pressly"}
+	assert.NoError(t, sess.Save(acct))
+
+	txA, err := sess.NewSessionTx(nil)
+	assert.NoError(t, err)
+	txB, err := sess.NewSessionTx(nil)
+	assert.NoError(t, err)
+
+	// Rows written by different transactions are all kept.
+	assert.NoError(t, txA.Save(&Account{Name: "A"}))
+	assert.NoError(t, txB.Save(&Account{Name: "B"}))
+
+	// Writes to the same row conflict.
+	assert.NoError(t, txA.Save(&Account{ID: acct.ID, Name: "Updated by A"}))
+	assert.NoError(t, txB.Save(&Account{ID: acct.ID, Name: "Updated by B"}))
+
+	assert.NoError(t, txA.TxCommit())
+	assert.Equal(t, memdb.ErrConflict, txB.TxCommit())
+
+	var names []string
+	var accts []Account
+	assert.NoError(t, sess.Store("accounts").Find().OrderBy("id").All(&accts))
+	for _, a := range accts {
+		names = append(names, a.Name)
+	}
+	assert.Equal(t, []string{"Updated by A", "A"}, names)
+}
+
+func TestSQLSemantics(t *testing.T) {
+	sess := memdb.New(memdb.Schema{"tags": {"id"}})
+	tags := sess.Store("tags")
+
+	// Keys of different types are different keys.
+	_, err := tags.Insert(map[string]interface{}{"id": 1, "name": "one"})
+	assert.NoError(t, err)
+	_, err = tags.Insert(map[string]interface{}{"id": "1", "name": nil})
+	assert.NoError(t, err)
+
+	count, err := tags.Find(db.Cond{"id": "1"}).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+
+	// Comparisons with NULL are never true.
+	count, err = tags.Find(db.Cond{"name": nil}).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+
+	count, err = tags.Find(db.Cond{"name =": nil}).Count()
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+
+	count, err = tags.Find(db.Cond{"name !=": "one"}).Count()
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestSQLBuilder(t *testing.T) {
+	sess := newSession()
+	assert.NoError(t, sess.Save(&Account{Name: "Pressly"}))
+	assert.NoError(t, sess.Save(&Account{Name: "Other"}))
+
+	res, err := sess.Update("accounts").
+		Set(map[string]interface{}{"disabled": true}).
+		Where(db.Cond{"name": "Pressly"}).
+		Exec()
+	assert.NoError(t, err)
+	n, err := res.RowsAffected()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	res, err = sess.DeleteFrom("accounts").Where(db.Cond{"disabled": false}).Exec()
+	assert.NoError(t, err)
+	n, err = res.RowsAffected()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	// Everything else fails with ErrSQLNotSupported.
+	var accts []Account
+	err = sess.SelectFrom("accounts").Where("name = ?", "Pressly").All(&accts)
+	assert.Equal(t, memdb.ErrSQLNotSupported, err)
+
+	_, err = sess.InsertInto("accounts").Values(&Account{Name: "New"}).Exec()
+	assert.Equal(t, memdb.ErrSQLNotSupported, err)
+
+	_, err = sess.DeleteFrom("accounts").Where("id = ?", 1).Exec()
+	assert.Equal(t, memdb.ErrSQLNotSupported, err)
+}
+
+type Audit struct {
+	CreatedBy string `db:"created_by"`
+}
+
+type Settings struct {
+	Theme string `db:"theme"`
+}
+
+type AuditedAccount struct {
+	*Audit
+	ID       int64    `db:"id,omitempty"`
+	Name     string   `db:"name"`
+	Settings Settings `db:"settings,inline"`
+	Note     string
+	ignored  string
+}
+
+func TestFieldMapping(t *testing.T) {
+	sess := newSession()
+
+	_, err := sess.Store("accounts").Insert(&AuditedAccount{
+		Audit:    &Audit{CreatedBy: "admin"},
+		Name:     "Pressly",
+		Settings: Settings{Theme: "dark"},
+		Note:     "untagged",
+		ignored:  "unexported",
+	})
+	assert.NoError(t, err)
+
+	// Columns are named as upper.io/db names them.
+	var row map[string]interface{}
+	err = sess.Store("accounts").Find(db.Cond{"id": 1}).One(&row)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id":         int64(1),
+		"name":       "Pressly",
+		"created_by": "admin",
+		"theme":      "dark",
+		"Note":       "untagged",
+	}, row)
+
+	var acct AuditedAccount
+	err = sess.Store("accounts").Find(db.Cond{"id": 1}).One(&acct)
+	assert.NoError(t, err)
+	if assert.NotNil(t, acct.Audit) {
+		assert.Equal(t, "admin", acct.CreatedBy)
+	}
+	assert.Equal(t, "dark", acct.Settings.Theme)
+	assert.Equal(t, "untagged", acct.Note)
+}
@@ -0,0 +1,679 @@
+package memdb
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"upper.io/db.v3"
+)
+
+// result is a lazy result set on a collection, rows are fetched the first time
+// Next is called.
+type result struct {
+	c *collection
+
+	conds   []interface{}
+	columns []string
+	orderBy []string
+	limit   int
+	offset  int
+
+	pageSize     uint
+	page         uint
+	cursorColumn string
+	reverse      bool
+
+	err error
+
+	// Iteration state.
+	fetched bool
+	rows    []row
+	pos     int
+}
+
+var _ db.Result = &result{}
+
+// clone returns a copy of the result set without its iteration state.
+func (r *result) clone() *result {
+	c := *r
+	c.conds = append([]interface{}(nil), r.conds...)
+	c.columns = append([]string(nil), r.columns...)
+	c.orderBy = append([]string(nil), r.orderBy...)
+	c.fetched, c.rows, c.pos = false, nil, 0
+	return &c
+}
+
+func (r *result) String() string {
+	return fmt.Sprintf("memdb: %s %v", r.c.name, r.conds)
+}
+
+func (r *result) Limit(n int) db.Result {
+	c := r.clone()
+	c.limit = n
+	return c
+}
+
+func (r *result) Offset(n int) db.Result {
+	c := r.clone()
+	c.offset = n
+	return c
+}
+
+func (r *result) OrderBy(columns ...interface{}) db.Result {
+	c := r.clone()
+	c.orderBy = nil
+	for _, column := range columns {
+		s, ok := column.(string)
+		if !ok {
+			c.err = db.ErrUnsupported
+			continue
+		}
+		c.orderBy = append(c.orderBy, s)
+	}
+	return c
+}
+
+func (r *result) Select(columns ...interface{}) db.Result {
+	c := r.clone()
+	c.columns = nil
+	for _, column := range columns {
+		s, ok := column.(string)
+		if !ok {
+			c.err = db.ErrUnsupported
+			continue
+		}
+		c.columns = append(c.columns, s)
+	}
+	return c
+}
+
+func (r *result) Where(conds ...interface{}) db.Result {
+	c := r.clone()
+	c.conds = conds
+	return c
+}
+
+func (r *result) And(conds ...interface{}) db.Result {
+	c := r.clone()
+	c.conds = append(c.conds, conds...)
+	return c
+}
+
+func (r *result) Group(...interface{}) db.Result {
+	c := r.clone()
+	c.err = db.ErrUnsupported
+	return c
+}
+
+func (r *result) Paginate(pageSize uint) db.Result {
+	c := r.clone()
+	c.pageSize = pageSize
+	return c
+}
+
+func (r *result) Page(pageNumber uint) db.Result {
+	c := r.clone()
+	c.page = pageNumber
+	return c
+}
+
+func (r *result) Cursor(cursorColumn string) db.Result {
+	c := r.clone()
+	c.cursorColumn = cursorColumn
+	return c
+}
+
+func (r *result) NextPage(cursorValue interface{}) db.Result {
+	c := r.clone()
+	c.conds = append(c.conds, db.Cond{c.cursorColumn + " >": cursorValue})
+	c.orderBy = []string{c.cursorColumn}
+	c.reverse = false
+	return c
+}
+
+func (r *result) PrevPage(cursorValue interface{}) db.Result {
+	c := r.clone()
+	c.conds = append(c.conds, db.Cond{c.cursorColumn + " <": cursorValue})
+	c.orderBy = []string{"-" + c.cursorColumn}
+	c.reverse = true
+	return c
+}
+
+func (r *result) TotalPages() (uint, error) {
+	if r.pageSize == 0 {
+		return 1, nil
+	}
+	n, err := r.TotalEntries()
+	if err != nil {
+		return 0, err
+	}
+	return uint((n + uint64(r.pageSize) - 1) / uint64(r.pageSize)), nil
+}
+
+func (r *result) TotalEntries() (uint64, error) {
+	c := r.clone()
+	c.limit, c.offset, c.pageSize = 0, 0, 0
+	return c.Count()
+}
+
+func (r *result) Count() (uint64, error) {
+	c := r.clone()
+	c.limit, c.offset, c.pageSize = 0, 0, 0
+	rows, err := c.fetch()
+	return uint64(len(rows)), err
+}
+
+func (r *result) Exists() (bool, error) {
+	n, err := r.Count()
+	return n > 0, err
+}
+
+func (r *result) One(dest interface{}) error {
+	c := r.clone()
+	c.limit = 1
+	rows, err := c.fetch()
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return db.ErrNoMoreRows
+	}
+	return fromRow(rows[0], dest)
+}
+
+func (r *result) All(dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return ErrExpectingPointer
+	}
+
+	rows, err := r.clone().fetch()
+	if err != nil {
+		return err
+	}
+
+	slice := reflect.MakeSlice(v.Elem().Type(), len(rows), len(rows))
+	for i := range rows {
+		if err := assignRow(rows[i], slice.Index(i)); err != nil {
+			return err
+		}
+	}
+	v.Elem().Set(slice)
+	return nil
+}
+
+func (r *result) Next(dest interface{}) bool {
+	if !r.fetched {
+		r.rows, r.err = r.fetch()
+		r.fetched = true
+	}
+	if r.err != nil || r.pos >= len(r.rows) {
+		return false
+	}
+	r.err = fromRow(r.rows[r.pos], dest)
+	r.pos++
+	return r.err == nil
+}
+
+func (r *result) Err() error {
+	return r.err
+}
+
+func (r *result) Close() error {
+	r.fetched, r.rows, r.pos = true, nil, 0
+	return nil
+}
+
+func (r *result) Update(values interface{}) error {
+	_, err := r.update(values)
+	return err
+}
+
+func (r *result) Delete() error {
+	_, err := r.delete()
+	return err
+}
+
+// update sets values on the rows of the result set and returns the number of
+// rows updated.
+func (r *result) update(values interface{}) (int64, error) {
+	changes, err := toRow(values)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	c := r.clone()
+	err = c.c.withTable(true, func(t *table) error {
+		keys, err := c.match(t)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			updated := t.rows[k].clone()
+			for col, v := range changes {
+				updated[col] = v
+			}
+			if err := t.replace(k, updated); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// delete deletes the rows of the result set and returns the number of rows
+// deleted.
+func (r *result) delete() (int64, error) {
+	var n int64
+	c := r.clone()
+	err := c.c.withTable(true, func(t *table) error {
+		keys, err := c.match(t)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			t.delete(k)
+		}
+		n = int64(len(keys))
+		return nil
+	})
+	return n, err
+}
+
+// fetch returns copies of the rows that belong to the result set.
+func (r *result) fetch() ([]row, error) {
+	var rows []row
+	err := r.c.withTable(false, func(t *table) error {
+		keys, err := r.match(t)
+		if err != nil {
+			return err
+		}
+		rows = make([]row, len(keys))
+		for i, k := range keys {
+			rows[i] = r.project(t.rows[k])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r.reverse {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+	return rows, nil
+}
+
+// project returns a copy of the row with the selected columns only.
+func (r *result) project(src row) row {
+	if len(r.columns) == 0 || (len(r.columns) == 1 && r.columns[0] == "*") {
+		return src.clone()
+	}
+	dst := make(row, len(r.columns))
+	for _, column := range r.columns {
+		dst[column] = src[column]
+	}
+	return dst
+}
+
+// match returns the keys of the rows that match the result set's conditions,
+// in order and with limit and offset applied.
+func (r *result) match(t *table) ([]string, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var keys []string
+	for _, k := range t.keys {
+		ok, err := matchAll(t, t.rows[k], r.conds)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			keys = append(keys, k)
+		}
+	}
+
+	if len(r.orderBy) > 0 {
+		sort.SliceStable(keys, func(i, j int) bool {
+			return lessRows(t.rows[keys[i]], t.rows[keys[j]], r.orderBy)
+		})
+	}
+
+	limit, offset := r.limit, r.offset
+	if r.pageSize > 0 {
+		limit = int(r.pageSize)
+		if r.page > 1 && r.cursorColumn == "" {
+			offset = int(r.page-1) * int(r.pageSize)
+		}
+	}
+
+	if offset > 0 {
+		if offset > len(keys) {
+			offset = len(keys)
+		}
+		keys = keys[offset:]
+	}
+	if limit > 0 && limit < len(keys) {
+		keys = keys[:limit]
+	}
+	return keys, nil
+}
+
+func matchAll(t *table, r row, conds []interface{}) (bool, error) {
+	for _, cond := range conds {
+		ok, err := matchCond(t, r, cond)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchCond reports whether r satisfies cond.
+func matchCond(t *table, r row, cond interface{}) (bool, error) {
+	switch c := cond.(type) {
+	case nil:
+		return true, nil
+	case db.Cond:
+		for k, v := range c {
+			column, ok := k.(string)
+			if !ok {
+				return false, db.ErrUnsupported
+			}
+			ok, err := matchColumn(r, column, v)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case db.RawValue:
+		return false, db.ErrUnsupported
+	case db.Compound:
+		sentences := c.Sentences()
+		if c.Operator() == db.OperatorOr {
+			for _, sentence := range sentences {
+				ok, err := matchCond(t, r, sentence)
+				if err != nil || ok {
+					return ok, err
+				}
+			}
+			return len(sentences) == 0, nil
+		}
+		for _, sentence := range sentences {
+			ok, err := matchCond(t, r, sentence)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	// Any other value is compared against the primary key.
+	if len(t.pKeys) != 1 {
+		return false, db.ErrUnsupported
+	}
+	return matchColumn(r, t.pKeys[0], cond)
+}
+
+var comparisonOperators = map[db.ComparisonOperator]string{
+	db.ComparisonOperatorEqual:                "=",
+	db.ComparisonOperatorNotEqual:             "!=",
+	db.ComparisonOperatorLessThan:             "<",
+	db.ComparisonOperatorGreaterThan:          ">",
+	db.ComparisonOperatorLessThanOrEqualTo:    "<=",
+	db.ComparisonOperatorGreaterThanOrEqualTo: ">=",
+	db.ComparisonOperatorBetween:              "BETWEEN",
+	db.ComparisonOperatorNotBetween:           "NOT BETWEEN",
+	db.ComparisonOperatorIn:                   "IN",
+	db.ComparisonOperatorNotIn:                "NOT IN",
+	db.ComparisonOperatorIs:                   "IS",
+	db.ComparisonOperatorIsNot:                "IS NOT",
+	db.ComparisonOperatorLike:                 "LIKE",
+	db.ComparisonOperatorNotLike:              "NOT LIKE",
+	db.ComparisonOperatorRegExp:               "~",
+	db.ComparisonOperatorNotRegExp:            "!~",
+	db.ComparisonOperatorAfter:                ">",
+	db.ComparisonOperatorBefore:               "<",
+	db.ComparisonOperatorOnOrAfter:            ">=",
+	db.ComparisonOperatorOnOrBefore:           "<=",
+}
+
+// matchColumn evaluates a "column [operator]" key of a db.Cond.
+func matchColumn(r row, key string, value interface{}) (bool, error) {
+	parts := strings.Fields(key)
+	if len(parts) == 0 {
+		return false, db.ErrUnsupported
+	}
+	column, op := parts[0], strings.ToUpper(strings.Join(parts[1:], " "))
+
+	if cmp, ok := value.(db.Comparison); ok {
+		if op, ok = comparisonOperators[cmp.Operator()]; !ok {
+			return false, db.ErrUnsupported
+		}
+		value = cmp.Value()
+	}
+
+	if op == "" {
+		switch {
+		case value == nil:
+			op = "IS"
+		case isList(value):
+			op = "IN"
+		default:
+			op = "="
+		}
+	}
+
+	current := r[column]
+	switch op {
+	case "IS":
+		return compare(current, value) == 0, nil
+	case "IS NOT":
+		return compare(current, value) != 0, nil
+	}
+
+	// As in SQL, comparisons with NULL are never true.
+	if current == nil {
+		return false, nil
+	}
+	switch op {
+	case "=", "==":
+		return value != nil && compare(current, value) == 0, nil
+	case "!=", "<>":
+		return value != nil && compare(current, value) != 0, nil
+	case "<":
+		return value != nil && compare(current, value) < 0, nil
+	case ">":
+		return value != nil && compare(current, value) > 0, nil
+	case "<=":
+		return value != nil && compare(current, value) <= 0, nil
+	case ">=":
+		return value != nil && compare(current, value) >= 0, nil
+	case "IN", "NOT IN":
+		found, null := false, false
+		for _, v := range toList(value) {
+			if v == nil {
+				null = true
+			} else if compare(current, v) == 0 {
+				found = true
+				break
+			}
+		}
+		if op == "IN" {
+			return found, nil
+		}
+		return !found && !null, nil
+	case "BETWEEN", "NOT BETWEEN":
+		bounds := toList(value)
+		if len(bounds) != 2 {
+			return false, db.ErrUnsupported
+		}
+		if bounds[0] == nil || bounds[1] == nil {
+			return false, nil
+		}
+		between := compare(current, bounds[0]) >= 0 && compare(current, bounds[1]) <= 0
+		return between == (op == "BETWEEN"), nil
+	case "LIKE", "NOT LIKE", "ILIKE", "NOT ILIKE":
+		pattern := "^" + regexp.QuoteMeta(fmt.Sprintf("%v", value)) + "$"
+		pattern = strings.NewReplacer("%", ".*", "_", ".").Replace(pattern)
+		if strings.HasSuffix(op, "ILIKE") {
+			pattern = "(?i)" + pattern
+		}
+		return matchRegexp(current, pattern, !strings.HasPrefix(op, "NOT"))
+	case "~", "REGEXP":
+		return matchRegexp(current, fmt.Sprintf("%v", value), true)
+	case "!~", "NOT REGEXP":
+		return matchRegexp(current, fmt.Sprintf("%v", value), false)
+	}
+	return false, db.ErrUnsupported
+}
+
+func matchRegexp(value interface{}, pattern string, want bool) (bool, error) {
+	if value == nil {
+		return false, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(fmt.Sprintf("%v", value)) == want, nil
+}
+
+func isList(v interface{}) bool {
+	if _, ok := v.([]byte); ok {
+		return false
+	}
+	k := reflect.TypeOf(v).Kind()
+	return k == reflect.Slice || k == reflect.Array
+}
+
+func toList(v interface{}) []interface{} {
+	if v == nil || !isList(v) {
+		return []interface{}{v}
+	}
+	rv := reflect.ValueOf(v)
+	list := make([]interface{}, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list
+}
+
+// lessRows compares rows by the given columns, columns prefixed with "-" or
+// followed by "DESC" are sorted in descending order.
+func lessRows(a, b row, orderBy []string) bool {
+	for _, column := range orderBy {
+		desc := false
+		if strings.HasPrefix(column, "-") {
+			column, desc = column[1:], true
+		} else if parts := strings.Fields(column); len(parts) == 2 {
+			column, desc = parts[0], strings.EqualFold(parts[1], "DESC")
+		}
+
+		c := compare(a[column], b[column])
+		if c == 0 {
+			continue
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	return false
+}
+
+// normalize converts numbers into int64 or float64 so values of different
+// types can be compared.
+func normalize(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	}
+	return v
+}
+
+func isZero(v interface{}) bool {
+	return v == nil || reflect.ValueOf(v).IsZero()
+}
+
+// compare returns -1, 0 or 1 if a is less than, equal to or greater than b,
+// nil values come first.
+func compare(a, b interface{}) int {
+	a, b = normalize(a), normalize(b)
+
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	switch x := a.(type) {
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			return compareOrdered(x < y, x > y)
+		case float64:
+			return compareFloat(float64(x), y)
+		}
+	case float64:
+		switch y := b.(type) {
+		case int64:
+			return compareFloat(x, float64(y))
+		case float64:
+			return compareFloat(x, y)
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			return compareOrdered(!x && y, x && !y)
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return compareOrdered(x.Before(y), x.After(y))
+		}
+	}
+
+	// Values of different types are never equal.
+	if ta, tb := fmt.Sprintf("%T", a), fmt.Sprintf("%T", b); ta != tb {
+		return strings.Compare(ta, tb)
+	}
+	return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+}
+
+func compareFloat(x, y float64) int {
+	return compareOrdered(x < y, x > y)
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
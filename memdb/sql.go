@@ -0,0 +1,323 @@
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"upper.io/db.v3"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+// ErrExpectingPointer is returned when an item is not a pointer to a struct or
+// to a map.
+var ErrExpectingPointer = errors.New("memdb: expecting a pointer to a struct or a map")
+
+// ErrSQLNotSupported is returned when SQL is used on an in-memory database.
+var ErrSQLNotSupported = db.ErrUnsupported
+
+// Select returns a selector that fails with ErrSQLNotSupported.
+func (e *engine) Select(columns ...interface{}) sqlbuilder.Selector {
+	return &errSelector{err: ErrSQLNotSupported}
+}
+
+// SelectFrom returns a selector that fails with ErrSQLNotSupported.
+func (e *engine) SelectFrom(table ...interface{}) sqlbuilder.Selector {
+	return &errSelector{err: ErrSQLNotSupported}
+}
+
+// InsertInto returns an inserter that fails with ErrSQLNotSupported.
+func (e *engine) InsertInto(table string) sqlbuilder.Inserter {
+	return &errInserter{err: ErrSQLNotSupported}
+}
+
+// DeleteFrom returns a deleter for the rows of the given collection that
+// match db.Cond or db.Compound conditions.
+func (e *engine) DeleteFrom(table string) sqlbuilder.Deleter {
+	return &deleter{c: &collection{engine: e, name: table}}
+}
+
+// Update returns an updater for the rows of the given collection that match
+// db.Cond or db.Compound conditions.
+func (e *engine) Update(table string) sqlbuilder.Updater {
+	return &updater{c: &collection{engine: e, name: table}}
+}
+
+func (e *engine) Exec(query interface{}, args ...interface{}) (sql.Result, error) {
+	return nil, ErrSQLNotSupported
+}
+
+func (e *engine) ExecContext(ctx context.Context, query interface{}, args ...interface{}) (sql.Result, error) {
+	return nil, ErrSQLNotSupported
+}
+
+func (e *engine) Prepare(query interface{}) (*sql.Stmt, error) {
+	return nil, ErrSQLNotSupported
+}
+
+func (e *engine) PrepareContext(ctx context.Context, query interface{}) (*sql.Stmt, error) {
+	return nil, ErrSQLNotSupported
+}
+
+func (e *engine) Query(query interface{}, args ...interface{}) (*sql.Rows, error) {
+	return nil, ErrSQLNotSupported
+}
+
+func (e *engine) QueryContext(ctx context.Context, query interface{}, args ...interface{}) (*sql.Rows, error) {
+	return nil, ErrSQLNotSupported
+}
+
+func (e *engine) QueryRow(query interface{}, args ...interface{}) (*sql.Row, error) {
+	return nil, ErrSQLNotSupported
+}
+
+func (e *engine) QueryRowContext(ctx context.Context, query interface{}, args ...interface{}) (*sql.Row, error) {
+	return nil, ErrSQLNotSupported
+}
+
+func (e *engine) Iterator(query interface{}, args ...interface{}) sqlbuilder.Iterator {
+	return errIterator{ErrSQLNotSupported}
+}
+
+func (e *engine) IteratorContext(ctx context.Context, query interface{}, args ...interface{}) sqlbuilder.Iterator {
+	return errIterator{ErrSQLNotSupported}
+}
+
+// errIterator is an iterator that fails with err.
+type errIterator struct {
+	err error
+}
+
+func (it errIterator) All(destSlice interface{}) error    { return it.err }
+func (it errIterator) One(dest interface{}) error         { return it.err }
+func (it errIterator) ScanOne(dest ...interface{}) error  { return it.err }
+func (it errIterator) NextScan(dest ...interface{}) error { return it.err }
+func (it errIterator) Scan(dest ...interface{}) error     { return it.err }
+func (it errIterator) Next(dest ...interface{}) bool      { return false }
+func (it errIterator) Err() error                         { return it.err }
+func (it errIterator) Close() error                       { return nil }
+
+// execResult is the result of a statement that affected n rows.
+type execResult int64
+
+func (n execResult) LastInsertId() (int64, error) { return 0, ErrSQLNotSupported }
+func (n execResult) RowsAffected() (int64, error) { return int64(n), nil }
+
+// checkConds fails if conds are raw SQL.
+func checkConds(conds []interface{}) error {
+	for _, cond := range conds {
+		switch cond.(type) {
+		case string, db.RawValue:
+			return ErrSQLNotSupported
+		}
+	}
+	return nil
+}
+
+// updater updates the rows of a collection.
+type updater struct {
+	c      *collection
+	values interface{}
+	conds  []interface{}
+	limit  int
+	err    error
+}
+
+func (u *updater) with(fn func(c *updater)) sqlbuilder.Updater {
+	c := *u
+	c.conds = append([]interface{}(nil), u.conds...)
+	fn(&c)
+	return &c
+}
+
+// Set sets the values to update, given as a map or a struct. Columns and
+// values given as separate arguments aren't supported.
+func (u *updater) Set(values ...interface{}) sqlbuilder.Updater {
+	return u.with(func(c *updater) {
+		if len(values) != 1 {
+			c.err = ErrSQLNotSupported
+			return
+		}
+		c.values = values[0]
+	})
+}
+
+func (u *updater) Where(conds ...interface{}) sqlbuilder.Updater {
+	return u.with(func(c *updater) {
+		c.conds = conds
+	})
+}
+
+func (u *updater) And(conds ...interface{}) sqlbuilder.Updater {
+	return u.with(func(c *updater) {
+		c.conds = append(c.conds, conds...)
+	})
+}
+
+func (u *updater) Limit(n int) sqlbuilder.Updater {
+	return u.with(func(c *updater) {
+		c.limit = n
+	})
+}
+
+func (u *updater) Amend(func(queryIn string) (queryOut string)) sqlbuilder.Updater {
+	return u.with(func(c *updater) {
+		c.err = ErrSQLNotSupported
+	})
+}
+
+func (u *updater) Exec() (sql.Result, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+	if err := checkConds(u.conds); err != nil {
+		return nil, err
+	}
+	n, err := (&result{c: u.c, conds: u.conds, limit: u.limit}).update(u.values)
+	if err != nil {
+		return nil, err
+	}
+	return execResult(n), nil
+}
+
+func (u *updater) ExecContext(ctx context.Context) (sql.Result, error) {
+	return u.Exec()
+}
+
+func (u *updater) String() string {
+	return fmt.Sprintf("memdb: UPDATE %s %v", u.c.name, u.conds)
+}
+
+func (u *updater) Arguments() []interface{} {
+	return nil
+}
+
+// deleter deletes the rows of a collection.
+type deleter struct {
+	c     *collection
+	conds []interface{}
+	limit int
+	err   error
+}
+
+func (d *deleter) with(fn func(c *deleter)) sqlbuilder.Deleter {
+	c := *d
+	c.conds = append([]interface{}(nil), d.conds...)
+	fn(&c)
+	return &c
+}
+
+func (d *deleter) Where(conds ...interface{}) sqlbuilder.Deleter {
+	return d.with(func(c *deleter) {
+		c.conds = conds
+	})
+}
+
+func (d *deleter) And(conds ...interface{}) sqlbuilder.Deleter {
+	return d.with(func(c *deleter) {
+		c.conds = append(c.conds, conds...)
+	})
+}
+
+func (d *deleter) Limit(n int) sqlbuilder.Deleter {
+	return d.with(func(c *deleter) {
+		c.limit = n
+	})
+}
+
+func (d *deleter) Amend(func(queryIn string) (queryOut string)) sqlbuilder.Deleter {
+	return d.with(func(c *deleter) {
+		c.err = ErrSQLNotSupported
+	})
+}
+
+func (d *deleter) Exec() (sql.Result, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if err := checkConds(d.conds); err != nil {
+		return nil, err
+	}
+	n, err := (&result{c: d.c, conds: d.conds, limit: d.limit}).delete()
+	if err != nil {
+		return nil, err
+	}
+	return execResult(n), nil
+}
+
+func (d *deleter) ExecContext(ctx context.Context) (sql.Result, error) {
+	return d.Exec()
+}
+
+func (d *deleter) String() string {
+	return fmt.Sprintf("memdb: DELETE FROM %s %v", d.c.name, d.conds)
+}
+
+func (d *deleter) Arguments() []interface{} {
+	return nil
+}
+
+// errSelector is a selector that fails with err. Methods that aren't
+// overridden, like joins, aren't supported and panic.
+type errSelector struct {
+	sqlbuilder.Selector
+	err error
+}
+
+func (s *errSelector) Columns(...interface{}) sqlbuilder.Selector  { return s }
+func (s *errSelector) From(...interface{}) sqlbuilder.Selector     { return s }
+func (s *errSelector) Distinct(...interface{}) sqlbuilder.Selector { return s }
+func (s *errSelector) As(string) sqlbuilder.Selector               { return s }
+func (s *errSelector) Where(...interface{}) sqlbuilder.Selector    { return s }
+func (s *errSelector) And(...interface{}) sqlbuilder.Selector      { return s }
+func (s *errSelector) GroupBy(...interface{}) sqlbuilder.Selector  { return s }
+func (s *errSelector) OrderBy(...interface{}) sqlbuilder.Selector  { return s }
+func (s *errSelector) Limit(int) sqlbuilder.Selector               { return s }
+func (s *errSelector) Offset(int) sqlbuilder.Selector              { return s }
+func (s *errSelector) Amend(func(string) string) sqlbuilder.Selector {
+	return s
+}
+func (s *errSelector) Paginate(uint) sqlbuilder.Paginator {
+	return &errPaginator{err: s.err}
+}
+func (s *errSelector) Iterator() sqlbuilder.Iterator { return errIterator{s.err} }
+func (s *errSelector) IteratorContext(context.Context) sqlbuilder.Iterator {
+	return errIterator{s.err}
+}
+func (s *errSelector) All(destSlice interface{}) error { return s.err }
+func (s *errSelector) One(dest interface{}) error      { return s.err }
+func (s *errSelector) String() string                  { return "" }
+func (s *errSelector) Arguments() []interface{}        { return nil }
+
+// errPaginator is a paginator that fails with err.
+type errPaginator struct {
+	sqlbuilder.Paginator
+	err error
+}
+
+func (p *errPaginator) Page(uint) sqlbuilder.Paginator  { return p }
+func (p *errPaginator) All(destSlice interface{}) error { return p.err }
+
+// errInserter is an inserter that fails with err.
+type errInserter struct {
+	sqlbuilder.Inserter
+	err error
+}
+
+func (i *errInserter) Columns(...string) sqlbuilder.Inserter     { return i }
+func (i *errInserter) Values(...interface{}) sqlbuilder.Inserter { return i }
+func (i *errInserter) Returning(...string) sqlbuilder.Inserter   { return i }
+func (i *errInserter) Amend(func(string) string) sqlbuilder.Inserter {
+	return i
+}
+func (i *errInserter) Iterator() sqlbuilder.Iterator { return errIterator{i.err} }
+func (i *errInserter) IteratorContext(context.Context) sqlbuilder.Iterator {
+	return errIterator{i.err}
+}
+func (i *errInserter) Exec() (sql.Result, error) { return nil, i.err }
+func (i *errInserter) ExecContext(context.Context) (sql.Result, error) {
+	return nil, i.err
+}
+func (i *errInserter) String() string           { return "" }
+func (i *errInserter) Arguments() []interface{} { return nil }
@@ -0,0 +1,76 @@
+package migrate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// LoadDir registers the SQL migrations in dir. Files are named after the
+// version and name of the migration and the direction they run in, e.g.
+// "0001_create_accounts.up.sql" and "0001_create_accounts.down.sql". Other
+// files are ignored.
+func (m *Migrator) LoadDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	type step struct {
+		name     string
+		up, down string
+	}
+	steps := make(map[int64]*step)
+
+	for _, file := range files {
+		match := fileName.FindStringSubmatch(file.Name())
+		if file.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("migrate: %s: %v", file.Name(), err)
+		}
+
+		query, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return err
+		}
+
+		s, ok := steps[version]
+		if !ok {
+			s = &step{name: match[2]}
+			steps[version] = s
+		}
+		if s.name != match[2] {
+			return fmt.Errorf("migrate: version %d is named both %q and %q", version, s.name, match[2])
+		}
+		if match[3] == "up" {
+			s.up = string(query)
+		} else {
+			s.down = string(query)
+		}
+	}
+
+	versions := make([]int64, 0, len(steps))
+	for version := range steps {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	for _, version := range versions {
+		s := steps[version]
+		if s.up == "" {
+			return fmt.Errorf("migrate: missing up migration for %d_%s", version, s.name)
+		}
+		if err := m.AddSQL(version, s.name, s.up, s.down); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+// Package migrate runs ordered schema migrations against a bond session.
+//
+// Migrations are either Go functions or SQL statements, each one runs in its
+// own transaction and is recorded in a version table once applied. While
+// migrating, an advisory lock is held so concurrent instances of an
+// application never run the same migrations twice.
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"upper.io/bond"
+	"upper.io/db.v3"
+)
+
+// DefaultTableName is the name of the table applied versions are recorded in.
+const DefaultTableName = "schema_migrations"
+
+// MigrationFunc applies or reverts a migration within the given transaction.
+type MigrationFunc func(tx bond.Session) error
+
+// Migration is a single step of the schema.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      MigrationFunc
+	Down    MigrationFunc
+}
+
+// Status is the state of a migration.
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type record struct {
+	Version   int64     `db:"version"`
+	Name      string    `db:"name"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+// Migrator runs migrations against a session.
+type Migrator struct {
+	// TableName is the table applied versions are recorded in, it's created
+	// when missing.
+	TableName string
+
+	sess       bond.Session
+	migrations []*Migration
+}
+
+// New returns a migrator without migrations.
+func New(sess bond.Session) *Migrator {
+	return &Migrator{
+		TableName: DefaultTableName,
+		sess:      sess,
+	}
+}
+
+// Add registers a Go migration, down may be nil for migrations that can't be
+// reverted.
+func (m *Migrator) Add(version int64, name string, up, down MigrationFunc) error {
+	if version <= 0 {
+		return fmt.Errorf("migrate: invalid version %d", version)
+	}
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return fmt.Errorf("migrate: duplicate version %d", version)
+		}
+	}
+
+	m.migrations = append(m.migrations, &Migration{
+		Version: version,
+		Name:    name,
+		Up:      up,
+		Down:    down,
+	})
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+	return nil
+}
+
+// AddSQL registers a migration made of SQL statements, down may be empty for
+// migrations that can't be reverted.
+func (m *Migrator) AddSQL(version int64, name string, up, down string) error {
+	var downFn MigrationFunc
+	if down != "" {
+		downFn = execSQL(down)
+	}
+	return m.Add(version, name, execSQL(up), downFn)
+}
+
+// Migrations returns the registered migrations in order.
+func (m *Migrator) Migrations() []*Migration {
+	return append([]*Migration(nil), m.migrations...)
+}
+
+// Up applies all pending migrations in order.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(sess bond.Session) error {
+		applied, err := m.applied(sess)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.apply(sess, mig); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts applied migrations newer than target, newest first. Use a
+// target of 0 to revert every migration.
+func (m *Migrator) Down(ctx context.Context, target int64) error {
+	return m.withLock(ctx, func(sess bond.Session) error {
+		applied, err := m.applied(sess)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if mig.Version <= target {
+				break
+			}
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if err := m.revert(sess, mig); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Version returns the newest applied version, or 0 if none was applied.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	sess := m.sess.WithContext(ctx)
+	if !m.tableExists(sess) {
+		return 0, nil
+	}
+
+	var records []record
+	err := sess.Store(m.TableName).Find().OrderBy("-version").Limit(1).All(&records)
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+	return records[0].Version, nil
+}
+
+// Status returns the state of every registered migration, in order.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	sess := m.sess.WithContext(ctx)
+	applied := map[int64]record{}
+	if m.tableExists(sess) {
+		var err error
+		if applied, err = m.applied(sess); err != nil {
+			return nil, err
+		}
+	}
+
+	status := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := Status{Version: mig.Version, Name: mig.Name}
+		if r, ok := applied[mig.Version]; ok {
+			st.Applied = true
+			st.AppliedAt = r.AppliedAt
+		}
+		status = append(status, st)
+	}
+	return status, nil
+}
+
+func (m *Migrator) apply(sess bond.Session, mig *Migration) error {
+	err := sess.SessionTx(sess.Context(), func(tx bond.Session) error {
+		if mig.Up != nil {
+			if err := mig.Up(tx); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Store(m.TableName).Insert(record{
+			Version:   mig.Version,
+			Name:      mig.Name,
+			AppliedAt: time.Now().UTC(),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("migrate: applying %d_%s: %v", mig.Version, mig.Name, err)
+	}
+	return nil
+}
+
+func (m *Migrator) revert(sess bond.Session, mig *Migration) error {
+	if mig.Down == nil {
+		return fmt.Errorf("migrate: %d_%s can't be reverted", mig.Version, mig.Name)
+	}
+	err := sess.SessionTx(sess.Context(), func(tx bond.Session) error {
+		if err := mig.Down(tx); err != nil {
+			return err
+		}
+		return tx.Store(m.TableName).Find(db.Cond{"version": mig.Version}).Delete()
+	})
+	if err != nil {
+		return fmt.Errorf("migrate: reverting %d_%s: %v", mig.Version, mig.Name, err)
+	}
+	return nil
+}
+
+func (m *Migrator) applied(sess bond.Session) (map[int64]record, error) {
+	var records []record
+	if err := sess.Store(m.TableName).Find().All(&records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]record, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+func (m *Migrator) createTable(sess bond.Session) error {
+	_, err := sess.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(256) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`, m.TableName))
+	return err
+}
+
+// tableExists reports whether the versions table was created. Only Up and
+// Down create it, while holding the migrator's lock, so that concurrent first
+// runs don't race to create it.
+func (m *Migrator) tableExists(sess bond.Session) bool {
+	return sess.Collection(m.TableName).Exists()
+}
+
+// withLock runs fn while holding the migrator's advisory lock. The lock is
+// held by a connection of its own, the database releases it if the
+// connection is lost so a crashed migrator never keeps the lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(sess bond.Session) error) error {
+	return m.sess.WithAdvisoryLock(ctx, m.lockName(), func(sess bond.Session) error {
+		if err := m.createTable(sess); err != nil {
+			return err
+		}
+		return fn(sess)
+	})
+}
+
+// lockName returns the name of the migrator's advisory lock, migrators of
+// different version tables don't block each other.
+func (m *Migrator) lockName() string {
+	return "bond/migrate:" + m.TableName
+}
+
+func execSQL(query string) MigrationFunc {
+	return func(tx bond.Session) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
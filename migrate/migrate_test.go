@@ -0,0 +1,174 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/bond/migrate"
+	"upper.io/db.v3/postgresql"
+)
+
+var DB bond.Session
+
+func pickDefault(env string, def string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	return def
+}
+
+func TestMain(m *testing.M) {
+	sess, err := postgresql.Open(postgresql.ConnectionURL{
+		Host:     fmt.Sprintf("%s:%s", pickDefault("DB_HOST", "127.0.0.1"), pickDefault("DB_PORT", "5432")),
+		Database: pickDefault("BOND_DB", "bond_test"),
+		User:     pickDefault("BOND_USER", "bond_user"),
+		Password: pickDefault("BOND_PASSWORD", "bond_password"),
+	})
+	status := -1
+	if err == nil {
+		DB = bond.New(sess)
+		status = m.Run()
+	}
+	os.Exit(status)
+}
+
+func reset(t *testing.T, tableName string) {
+	for _, table := range []string{tableName, "migrate_widgets"} {
+		_, err := DB.Exec("DROP TABLE IF EXISTS " + table)
+		assert.NoError(t, err)
+	}
+}
+
+func newMigrator(t *testing.T) *migrate.Migrator {
+	m := migrate.New(DB)
+	m.TableName = "migrate_test_versions"
+	reset(t, m.TableName)
+	t.Cleanup(func() { reset(t, m.TableName) })
+
+	err := m.LoadDir("testdata/migrations")
+	assert.NoError(t, err)
+	return m
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	m := newMigrator(t)
+
+	err := m.Add(3, "seed_widgets", func(tx bond.Session) error {
+		_, err := tx.Store("migrate_widgets").Insert(map[string]interface{}{"name": "gear", "color": "red"})
+		return err
+	}, func(tx bond.Session) error {
+		return tx.Store("migrate_widgets").Truncate()
+	})
+	assert.NoError(t, err)
+
+	err = m.Up(ctx)
+	assert.NoError(t, err)
+
+	version, err := m.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), version)
+
+	count, err := DB.Store("migrate_widgets").Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+
+	// Running again is a no-op.
+	err = m.Up(ctx)
+	assert.NoError(t, err)
+
+	err = m.Down(ctx, 1)
+	assert.NoError(t, err)
+
+	status, err := m.Status(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, status, 3) {
+		assert.True(t, status[0].Applied)
+		assert.Equal(t, "create_widgets", status[0].Name)
+		assert.False(t, status[1].Applied)
+		assert.False(t, status[2].Applied)
+	}
+
+	err = m.Down(ctx, 0)
+	assert.NoError(t, err)
+
+	version, err = m.Version(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, version)
+}
+
+func TestFailedMigration(t *testing.T) {
+	ctx := context.Background()
+	m := newMigrator(t)
+
+	err := m.Add(3, "broken", func(tx bond.Session) error {
+		if _, err := tx.Exec("ALTER TABLE migrate_widgets ADD COLUMN size integer"); err != nil {
+			return err
+		}
+		return errors.New("broken migration")
+	}, nil)
+	assert.NoError(t, err)
+
+	err = m.Up(ctx)
+	assert.Error(t, err)
+
+	// Migrations before the broken one stay applied, the broken one is
+	// rolled back.
+	version, err := m.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+
+	_, err = DB.Exec("SELECT size FROM migrate_widgets")
+	assert.Error(t, err)
+}
+
+func TestConcurrentUp(t *testing.T) {
+	ctx := context.Background()
+	newMigrator(t)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m := migrate.New(DB)
+			m.TableName = "migrate_test_versions"
+			if err := m.LoadDir("testdata/migrations"); err != nil {
+				errs[i] = err
+				return
+			}
+			errs[i] = m.Up(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
+func TestReadBeforeUp(t *testing.T) {
+	ctx := context.Background()
+	m := newMigrator(t)
+
+	version, err := m.Version(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, version)
+
+	status, err := m.Status(ctx)
+	assert.NoError(t, err)
+	for _, st := range status {
+		assert.False(t, st.Applied)
+	}
+
+	// Reads don't create the versions table, only Up and Down do while
+	// holding the migrator's lock.
+	assert.False(t, DB.Collection(m.TableName).Exists())
+}
@@ -0,0 +1,4 @@
+CREATE TABLE migrate_widgets (
+  id serial primary key,
+  name varchar(256)
+);
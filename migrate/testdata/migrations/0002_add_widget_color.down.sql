@@ -0,0 +1 @@
+ALTER TABLE migrate_widgets DROP COLUMN color;
@@ -0,0 +1 @@
+ALTER TABLE migrate_widgets ADD COLUMN color varchar(64);
@@ -0,0 +1,158 @@
+package bond
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	listenerMinReconnectInterval = 100 * time.Millisecond
+	listenerMaxReconnectInterval = 10 * time.Second
+	listenerPingInterval         = 90 * time.Second
+)
+
+// ChangeOp represents the kind of change that was made to an item.
+type ChangeOp string
+
+// Change operations.
+const (
+	ChangeCreate ChangeOp = "create"
+	ChangeUpdate ChangeOp = "update"
+	ChangeDelete ChangeOp = "delete"
+
+	// ChangeResync is sent after the listener reconnects to the database,
+	// notifications that were sent while disconnected are lost so subscribers
+	// should assume that anything could have changed.
+	ChangeResync ChangeOp = "resync"
+)
+
+// ChangeEvent describes a change made by a store on a collection.
+type ChangeEvent struct {
+	Collection string                 `json:"collection"`
+	Op         ChangeOp               `json:"op"`
+	PrimaryKey map[string]interface{} `json:"pk,omitempty"`
+}
+
+type hasNotifications interface {
+	notificationsEnabled() bool
+}
+
+// notifyChannel returns the name of the PostgreSQL channel used to publish
+// changes on the given collection.
+func notifyChannel(collectionName string) string {
+	return "bond." + collectionName
+}
+
+// WithNotifications returns a copy of the session that publishes a
+// notification with pg_notify each time a store creates, updates or deletes an
+// item. Notifications issued within a transaction are only delivered after the
+// transaction is committed.
+//
+// Outside a transaction the notification is sent after the change is written,
+// if it fails the change is kept and the store returns an error whose cause is
+// ErrNotifyFailed. Use a transaction to make the change and its notification
+// atomic.
+func (s *session) WithNotifications() Session {
+	sess := s.clone(s.Backend)
+	sess.notify = true
+	return sess
+}
+
+func (s *session) notificationsEnabled() bool {
+	return s.notify
+}
+
+// Subscribe listens for changes on the given collection and sends them to the
+// returned channel. The listener reconnects automatically when the connection
+// is lost, a ChangeResync event is sent after every reconnection. The channel
+// is closed when ctx is done. Collections are looked up in the session's
+// schema, like stores.
+func (s *session) Subscribe(ctx context.Context, collectionName string) (<-chan ChangeEvent, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	connURL := s.ConnectionURL()
+	if connURL == nil {
+		return nil, ErrMissingConnectionURL
+	}
+
+	listener := pq.NewListener(connURL.String(), listenerMinReconnectInterval, listenerMaxReconnectInterval, nil)
+	if err := listener.Listen(notifyChannel(s.qualifiedName(collectionName))); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	events := make(chan ChangeEvent)
+	go func() {
+		defer close(events)
+		defer listener.Close()
+
+		ticker := time.NewTicker(listenerPingInterval)
+		defer ticker.Stop()
+
+		for {
+			var ev ChangeEvent
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				go listener.Ping()
+				continue
+			case n := <-listener.Notify:
+				if n == nil {
+					ev = ChangeEvent{Op: ChangeResync}
+				} else if err := json.Unmarshal([]byte(n.Extra), &ev); err != nil {
+					continue
+				}
+			}
+
+			ev.Collection = collectionName
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// notify publishes a change on the store's collection if the session has
+// notifications enabled.
+func (s *store) notify(op ChangeOp, item interface{}) error {
+	if n, ok := s.session.(hasNotifications); !ok || !n.notificationsEnabled() {
+		return nil
+	}
+
+	pKeys := s.Collection.(hasPrimaryKeys).PrimaryKeys()
+	ev := ChangeEvent{
+		Collection: s.Collection.Name(),
+		Op:         op,
+		PrimaryKey: make(map[string]interface{}, len(pKeys)),
+	}
+	for i, field := range mapper.FieldsByName(reflect.ValueOf(item), pKeys) {
+		if field.IsValid() {
+			ev.PrimaryKey[pKeys[i]] = field.Interface()
+		}
+	}
+
+	payload, err := json.Marshal(ev)
+	if err == nil {
+		_, err = s.session.Exec("SELECT pg_notify(?, ?)", notifyChannel(ev.Collection), string(payload))
+	}
+	if err != nil {
+		if tx, ok := s.session.(hasTx); ok && tx.inTx() {
+			return err
+		}
+		return errors.Wrapf(ErrNotifyFailed, "bond: %s on %s was committed: %v", op, ev.Collection, err)
+	}
+	return nil
+}
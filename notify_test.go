@@ -0,0 +1,111 @@
+package bond_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/db.v3"
+)
+
+func TestNotifications(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := DB.Subscribe(ctx, "accounts")
+	assert.NoError(t, err)
+
+	sess := DB.WithNotifications()
+
+	acct := &Account{Name: "Notified"}
+	err = sess.Save(acct)
+	assert.NoError(t, err)
+
+	select {
+	case ev := <-events:
+		assert.Equal(t, "accounts", ev.Collection)
+		assert.Equal(t, bond.ChangeCreate, ev.Op)
+		assert.EqualValues(t, acct.ID, ev.PrimaryKey["id"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("expecting a notification")
+	}
+
+	// Notifications sent within a transaction are delivered after commit.
+	err = sess.SessionTx(nil, func(tx bond.Session) error {
+		return tx.Delete(acct)
+	})
+	assert.NoError(t, err)
+
+	select {
+	case ev := <-events:
+		assert.Equal(t, bond.ChangeDelete, ev.Op)
+		assert.EqualValues(t, acct.ID, ev.PrimaryKey["id"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("expecting a notification")
+	}
+
+	cancel()
+	_, ok := <-events
+	assert.False(t, ok)
+}
+
+func TestNotificationsWithSchema(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	schemaSess := DB.WithSchema("tenant_a")
+	events, err := schemaSess.Subscribe(ctx, "accounts")
+	assert.NoError(t, err)
+
+	acct := &Account{Name: "Notified in schema"}
+	err = schemaSess.WithNotifications().Save(acct)
+	assert.NoError(t, err)
+	defer schemaSess.Delete(acct)
+
+	select {
+	case ev := <-events:
+		assert.Equal(t, "accounts", ev.Collection)
+		assert.Equal(t, bond.ChangeCreate, ev.Op)
+		assert.EqualValues(t, acct.ID, ev.PrimaryKey["id"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("expecting a notification")
+	}
+}
+
+type notifiedItem struct {
+	ID   int64  `db:"id,omitempty"`
+	Name string `db:"name"`
+}
+
+func TestNotificationFailure(t *testing.T) {
+	// PostgreSQL rejects channel names longer than 63 bytes, the channel of
+	// this table is one.
+	table := "notify_" + strings.Repeat("x", 56)
+	_, err := DB.Exec(`CREATE TABLE ` + table + ` (id serial primary key, name text)`)
+	assert.NoError(t, err)
+	defer DB.Exec(`DROP TABLE ` + table)
+
+	// Outside a transaction the change is kept.
+	item := &notifiedItem{Name: "kept"}
+	err = DB.WithNotifications().Store(table).Save(item)
+	assert.Equal(t, bond.ErrNotifyFailed, errors.Cause(err))
+
+	count, err := DB.Store(table).Find(db.Cond{"name": "kept"}).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+
+	// Within a transaction the change is rolled back with its notification.
+	err = DB.WithNotifications().SessionTx(nil, func(tx bond.Session) error {
+		return tx.Store(table).Save(&notifiedItem{Name: "rolled back"})
+	})
+	assert.Error(t, err)
+	assert.NotEqual(t, bond.ErrNotifyFailed, errors.Cause(err))
+
+	count, err = DB.Store(table).Find(db.Cond{"name": "rolled back"}).Count()
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,370 @@
+package bond
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"upper.io/db.v3"
+)
+
+// QueryEvent describes a query run by a session.
+type QueryEvent struct {
+	Query        string
+	Args         []interface{}
+	Start        time.Time
+	Duration     time.Duration
+	RowsAffected int64 // zero when unknown
+	Err          error
+
+	// Collection and Model identify the store and the model the query was
+	// run for, they're empty for queries that didn't go through a store.
+	Collection string
+	Model      string
+
+	// Context is the context the query ran with.
+	Context context.Context
+}
+
+// QueryObserver receives every query run by a session, see
+// Session.WithObserver.
+type QueryObserver interface {
+	ObserveQuery(*QueryEvent)
+}
+
+// QueryObserverFunc is a function that observes queries.
+type QueryObserverFunc func(*QueryEvent)
+
+// ObserveQuery calls f(e).
+func (f QueryObserverFunc) ObserveQuery(e *QueryEvent) {
+	f(e)
+}
+
+// StoreEvent describes a store operation: save, create, update or delete.
+type StoreEvent struct {
+	Op         string
+	Collection string
+	Model      string
+}
+
+// HookEvent describes a model hook invocation, Hook is the name of the hook
+// method, e.g. "BeforeCreate" or "Validate".
+type HookEvent struct {
+	Hook       string
+	Collection string
+	Model      string
+}
+
+// StoreObserver is implemented by query observers that also watch store
+// operations. StartStoreOp is called before the operation with the context
+// of the store's session, the returned context is carried by the queries and
+// hooks of the operation. The returned function is called with the result of
+// the operation.
+type StoreObserver interface {
+	StartStoreOp(ctx context.Context, e *StoreEvent) (context.Context, func(error))
+}
+
+// HookObserver is implemented by query observers that also watch model
+// hooks, see StoreObserver.
+type HookObserver interface {
+	StartHook(ctx context.Context, e *HookEvent) (context.Context, func(error))
+}
+
+// TxObserver is implemented by query observers that also watch transactions
+// run with SessionTx, see StoreObserver. The transaction was committed when
+// the returned function is called with a nil error, and rolled back
+// otherwise.
+type TxObserver interface {
+	StartTx(ctx context.Context) (context.Context, func(error))
+}
+
+type observerKey struct{}
+
+type originKey struct{}
+
+type queryOrigin struct {
+	collection string
+	model      string
+}
+
+type hasObserver interface {
+	queryObserver() QueryObserver
+	originCollection(backend Backend, name string, item interface{}) db.Collection
+}
+
+// WithObserver returns a copy of the session that reports every query it
+// runs, within transactions too, to the given observer. Other sessions of
+// the same database don't report their queries.
+//
+// Observers receive queries through the database's logger: the first observed
+// session of a database permanently installs a logger that dispatches queries
+// to observers and enables logging on the database. The previous logger keeps
+// receiving queries while logging is enabled through SetLogging and SetLogger
+// of bond sessions, which toggle the previous logger only. Calling SetLogging
+// or SetLogger on the underlying upper.io/db database stops observers.
+func (s *session) WithObserver(observer QueryObserver) Session {
+	installObserverLogger(s.Backend)
+	for _, replica := range s.replicas {
+		installObserverLogger(replica)
+	}
+
+	sess := s.clone(s.Backend)
+	sess.observer = observer
+	return sess.WithContext(s.Context())
+}
+
+func (s *session) queryObserver() QueryObserver {
+	return s.observer
+}
+
+// observedContext returns ctx carrying the session's observer, a nil ctx is
+// replaced by the session's context.
+func (s *session) observedContext(ctx context.Context) context.Context {
+	if s.observer == nil {
+		return ctx
+	}
+	if ctx == nil {
+		ctx = s.Context()
+	}
+	return context.WithValue(ctx, observerKey{}, s.observer)
+}
+
+// originCollection returns the named collection of backend, or of the
+// session's backend when backend is nil. Queries run on the collection are
+// reported as coming from the collection and from item's model.
+func (s *session) originCollection(backend Backend, name string, item interface{}) db.Collection {
+	if backend == nil {
+		backend = s.Backend
+	}
+	origin := &queryOrigin{collection: name, model: modelName(item)}
+
+	ctx := backend.(hasContext).Context()
+	return backendWithContext(backend, context.WithValue(ctx, originKey{}, origin)).Collection(name)
+}
+
+// collection returns the store's collection, bound to the origin of the
+// query when the session is observed.
+func (s *store) collection(item interface{}) db.Collection {
+	if o, ok := s.session.(hasObserver); ok && o.queryObserver() != nil {
+		return o.originCollection(nil, s.Collection.Name(), item)
+	}
+	return s.Collection
+}
+
+// startOp reports the start of a store operation to the session's observer.
+// It returns a copy of the store bound to the context of the operation and a
+// function that reports its end.
+func (s *store) startOp(op string, item interface{}) (*store, func(error)) {
+	o, ok := s.session.(hasObserver)
+	if !ok || s.Collection == nil {
+		return s, func(error) {}
+	}
+	so, ok := o.queryObserver().(StoreObserver)
+	if !ok {
+		return s, func(error) {}
+	}
+
+	ctx, end := so.StartStoreOp(s.session.Context(), &StoreEvent{
+		Op:         op,
+		Collection: s.name,
+		Model:      modelName(item),
+	})
+	return s.WithSession(s.session.WithContext(ctx)).(*store), end
+}
+
+// runHook runs the hook of item with the given name, reporting it to the
+// session's observer. Hooks observed run with a session bound to the context
+// returned by the observer.
+func (s *store) runHook(hook string, item interface{}, fn func(sess Session) error) error {
+	o, ok := s.session.(hasObserver)
+	if !ok {
+		return fn(s.session)
+	}
+	ho, ok := o.queryObserver().(HookObserver)
+	if !ok {
+		return fn(s.session)
+	}
+
+	ctx, end := ho.StartHook(s.session.Context(), &HookEvent{
+		Hook:       hook,
+		Collection: s.name,
+		Model:      modelName(item),
+	})
+	err := fn(s.session.WithContext(ctx))
+	end(err)
+	return err
+}
+
+func modelName(item interface{}) string {
+	if item == nil {
+		return ""
+	}
+	t := reflect.TypeOf(item)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+var observerLoggerMu sync.Mutex
+
+// installObserverLogger replaces the logger of the backend with one that
+// dispatches queries to the observer carried by their context. Queries are
+// still passed to the previous logger when logging was enabled.
+func installObserverLogger(backend Backend) {
+	observerLoggerMu.Lock()
+	defer observerLoggerMu.Unlock()
+
+	if _, ok := backend.Logger().(*observerLogger); ok {
+		return
+	}
+	logger := &observerLogger{
+		next:    backend.Logger(),
+		logging: backend.LoggingEnabled(),
+	}
+	backend.SetLogger(logger)
+	backend.SetLogging(true)
+}
+
+// SetLogging enables or disables query logging. Once a session of the database
+// was observed logging stays enabled for observers, and value only toggles
+// the logger given to SetLogger.
+func (s *session) SetLogging(value bool) {
+	if l, ok := s.Backend.Logger().(*observerLogger); ok {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.logging = value
+		return
+	}
+	s.Backend.SetLogging(value)
+}
+
+// LoggingEnabled reports whether query logging was enabled with SetLogging.
+func (s *session) LoggingEnabled() bool {
+	if l, ok := s.Backend.Logger().(*observerLogger); ok {
+		l.mu.RLock()
+		defer l.mu.RUnlock()
+		return l.logging
+	}
+	return s.Backend.LoggingEnabled()
+}
+
+// SetLogger sets the logger of the database's queries, observers keep
+// receiving queries.
+func (s *session) SetLogger(logger db.Logger) {
+	if l, ok := s.Backend.Logger().(*observerLogger); ok {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.next = logger
+		return
+	}
+	s.Backend.SetLogger(logger)
+}
+
+// observerLogger dispatches queries to observers, and to the database's
+// previous logger while logging is enabled.
+type observerLogger struct {
+	next    db.Logger
+	logging bool
+	mu      sync.RWMutex
+}
+
+func (l *observerLogger) Log(q *db.QueryStatus) {
+	l.mu.RLock()
+	next := l.next
+	if !l.logging {
+		next = nil
+	}
+	l.mu.RUnlock()
+	if next != nil {
+		next.Log(q)
+	}
+	if q.Context == nil {
+		return
+	}
+	observer, ok := q.Context.Value(observerKey{}).(QueryObserver)
+	if !ok {
+		return
+	}
+
+	e := &QueryEvent{
+		Query:    q.Query,
+		Args:     q.Args,
+		Start:    q.Start,
+		Duration: q.End.Sub(q.Start),
+		Err:      q.Err,
+		Context:  q.Context,
+	}
+	if q.RowsAffected != nil {
+		e.RowsAffected = *q.RowsAffected
+	}
+	if origin, ok := q.Context.Value(originKey{}).(*queryOrigin); ok {
+		e.Collection = origin.collection
+		e.Model = origin.model
+	}
+	observer.ObserveQuery(e)
+}
+
+// Observers returns an observer that reports to all the given observers,
+// optional interfaces like StoreObserver are forwarded to the observers that
+// implement them. Contexts returned by observers are passed to the next one.
+func Observers(observers ...QueryObserver) QueryObserver {
+	return multiObserver(observers)
+}
+
+type multiObserver []QueryObserver
+
+func (m multiObserver) ObserveQuery(e *QueryEvent) {
+	for _, o := range m {
+		o.ObserveQuery(e)
+	}
+}
+
+func (m multiObserver) StartStoreOp(ctx context.Context, e *StoreEvent) (context.Context, func(error)) {
+	return m.start(ctx, func(o QueryObserver, ctx context.Context) (context.Context, func(error), bool) {
+		if so, ok := o.(StoreObserver); ok {
+			ctx, end := so.StartStoreOp(ctx, e)
+			return ctx, end, true
+		}
+		return ctx, nil, false
+	})
+}
+
+func (m multiObserver) StartHook(ctx context.Context, e *HookEvent) (context.Context, func(error)) {
+	return m.start(ctx, func(o QueryObserver, ctx context.Context) (context.Context, func(error), bool) {
+		if ho, ok := o.(HookObserver); ok {
+			ctx, end := ho.StartHook(ctx, e)
+			return ctx, end, true
+		}
+		return ctx, nil, false
+	})
+}
+
+func (m multiObserver) StartTx(ctx context.Context) (context.Context, func(error)) {
+	return m.start(ctx, func(o QueryObserver, ctx context.Context) (context.Context, func(error), bool) {
+		if to, ok := o.(TxObserver); ok {
+			ctx, end := to.StartTx(ctx)
+			return ctx, end, true
+		}
+		return ctx, nil, false
+	})
+}
+
+// start calls fn with every observer, the returned function ends them in
+// reverse order.
+func (m multiObserver) start(ctx context.Context, fn func(QueryObserver, context.Context) (context.Context, func(error), bool)) (context.Context, func(error)) {
+	var ends []func(error)
+	for _, o := range m {
+		var end func(error)
+		var ok bool
+		if ctx, end, ok = fn(o, ctx); ok {
+			ends = append(ends, end)
+		}
+	}
+	return ctx, func(err error) {
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i](err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package bond_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/db.v3"
+)
+
+type recorder struct {
+	events []*bond.QueryEvent
+	mu     sync.Mutex
+}
+
+func (r *recorder) ObserveQuery(e *bond.QueryEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *recorder) find(fn func(e *bond.QueryEvent) bool) *bond.QueryEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.events {
+		if fn(e) {
+			return e
+		}
+	}
+	return nil
+}
+
+func TestObserver(t *testing.T) {
+	rec := &recorder{}
+	sess := DB.WithObserver(rec)
+
+	acct := &Account{Name: "Observed"}
+	err := sess.Save(acct)
+	assert.NoError(t, err)
+
+	insert := rec.find(func(e *bond.QueryEvent) bool {
+		return strings.HasPrefix(e.Query, "INSERT INTO \"accounts\"")
+	})
+	if assert.NotNil(t, insert) {
+		assert.Equal(t, "accounts", insert.Collection)
+		assert.Equal(t, "Account", insert.Model)
+		assert.NoError(t, insert.Err)
+		assert.Contains(t, insert.Args, "Observed")
+	}
+
+	// Queries of the AfterCreate hook run on the same session.
+	assert.NotNil(t, rec.find(func(e *bond.QueryEvent) bool {
+		return e.Collection == "logs" && e.Model == "Log"
+	}))
+
+	err = sess.SessionTx(nil, func(tx bond.Session) error {
+		_, err := tx.Store("accounts").Find(db.Cond{"id": acct.ID}).Count()
+		return err
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, rec.find(func(e *bond.QueryEvent) bool {
+		return strings.Contains(e.Query, "COUNT(1)") && e.Collection == "accounts" && e.Model == ""
+	}))
+
+	_, err = sess.Exec("SELECT missing FROM accounts")
+	assert.Error(t, err)
+	assert.NotNil(t, rec.find(func(e *bond.QueryEvent) bool {
+		return e.Err != nil && e.Collection == ""
+	}))
+
+	// Other sessions aren't observed.
+	n := len(rec.events)
+	_, err = DB.Store("accounts").Find().Count()
+	assert.NoError(t, err)
+	assert.Len(t, rec.events, n)
+
+	err = sess.Delete(acct)
+	assert.NoError(t, err)
+}
+
+func TestSlogObserver(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	// Every query is slow with a 1ns threshold.
+	sess := DB.WithObserver(bond.NewSlogObserver(logger, time.Nanosecond))
+	_, err := sess.Store("accounts").Find().Count()
+	assert.NoError(t, err)
+
+	out := buf.String()
+	assert.Contains(t, out, "level=WARN")
+	assert.Contains(t, out, `msg="bond: slow query"`)
+	assert.Contains(t, out, "collection=accounts")
+
+	buf.Reset()
+	sess = DB.WithObserver(bond.NewSlogObserver(logger, time.Hour))
+	_, err = sess.Store("accounts").Find().Count()
+	assert.NoError(t, err)
+	assert.Empty(t, buf.String())
+}
+
+type traceKey struct{}
+
+// traceHandler records the trace of the context of every record.
+type traceHandler struct {
+	traces []interface{}
+}
+
+func (h *traceHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *traceHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *traceHandler) WithGroup(string) slog.Handler            { return h }
+func (h *traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.traces = append(h.traces, ctx.Value(traceKey{}))
+	return nil
+}
+
+func TestSlogObserverContext(t *testing.T) {
+	h := &traceHandler{}
+	ctx := context.WithValue(context.Background(), traceKey{}, "trace-1")
+
+	sess := DB.WithObserver(bond.NewSlogObserver(slog.New(h), 0)).WithContext(ctx)
+	_, err := sess.Store("accounts").Find().Count()
+	assert.NoError(t, err)
+
+	// Handlers get the context of the query.
+	if assert.NotEmpty(t, h.traces) {
+		assert.Equal(t, "trace-1", h.traces[len(h.traces)-1])
+	}
+}
+
+func TestObserverLogging(t *testing.T) {
+	rec := &recorder{}
+	sess := DB.WithObserver(rec)
+
+	// Disabling logging doesn't stop observers.
+	enabled := DB.LoggingEnabled()
+	DB.SetLogging(false)
+	defer DB.SetLogging(enabled)
+	assert.False(t, sess.LoggingEnabled())
+
+	_, err := sess.Store("accounts").Find().Count()
+	assert.NoError(t, err)
+	assert.NotNil(t, rec.find(func(e *bond.QueryEvent) bool {
+		return e.Collection == "accounts"
+	}))
+}
@@ -0,0 +1,274 @@
+package bond
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"upper.io/db.v3"
+)
+
+// PageQuery selects a page of a keyset paginated result set.
+type PageQuery struct {
+	// Cond filters the items, nil matches every item.
+	Cond interface{}
+
+	// OrderBy lists the columns the items are sorted by, prefixed with "-"
+	// for descending order. The primary keys of the store are appended as
+	// tiebreakers. Columns should be indexed and must not be NULL.
+	OrderBy []string
+
+	// Size is the maximum number of items of the page.
+	Size uint
+
+	// Cursor is a cursor returned with a previous page, the first page is
+	// returned when it's empty.
+	Cursor string
+}
+
+// PageInfo holds the cursors of the pages around a page, they're empty when
+// there is no such page.
+type PageInfo struct {
+	Next string
+	Prev string
+}
+
+// pageCursor is the content of a cursor, the values of the ordering columns
+// of the item the page starts after, or before when Backward is set. Order
+// holds the ordering the cursor was created with, "-" prefixed columns are
+// descending.
+type pageCursor struct {
+	Order    []string          `json:"o"`
+	Values   []json.RawMessage `json:"v"`
+	Backward bool              `json:"b,omitempty"`
+}
+
+// Page fetches a page of items into dest, a pointer to a slice of structs,
+// using keyset pagination: pages start after the last item of the previous
+// page instead of at an offset, so every page is as fast as the first one.
+//
+//	var logs []Log
+//	page, err := sess.Store("logs").Page(&logs, bond.PageQuery{
+//		OrderBy: []string{"-created_at"},
+//		Size:    50,
+//		Cursor:  r.URL.Query().Get("cursor"),
+//	})
+//
+// Cursors are opaque tokens safe to use in URLs, a cursor can only be used
+// with the ordering it was created with.
+func (s *store) Page(dest interface{}, q PageQuery) (*PageInfo, error) {
+	if s.Collection == nil {
+		return nil, ErrInvalidCollection
+	}
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return nil, ErrExpectingPointerToSlice
+	}
+	if q.Size == 0 {
+		return nil, ErrInvalidQuery
+	}
+
+	columns, desc := s.pageOrder(q.OrderBy)
+
+	var cursor pageCursor
+	if q.Cursor != "" {
+		var err error
+		if cursor, err = decodePageCursor(q.Cursor, columns, desc); err != nil {
+			return nil, err
+		}
+	}
+
+	// Backward pages are fetched in reverse order, starting from the cursor.
+	orderBy := make([]interface{}, len(columns))
+	for i, column := range columns {
+		if desc[i] != cursor.Backward {
+			orderBy[i] = "-" + column
+		} else {
+			orderBy[i] = column
+		}
+	}
+
+	var res db.Result
+	if q.Cond == nil {
+		res = s.Find()
+	} else {
+		res = s.Find(q.Cond)
+	}
+	if q.Cursor != "" {
+		values, err := cursorValues(v.Type().Elem().Elem(), columns, cursor.Values)
+		if err != nil {
+			return nil, err
+		}
+		res = res.And(keysetCond(columns, desc, cursor.Backward, values))
+	}
+
+	// One more item than asked for tells whether there's a page after this
+	// one.
+	if err := res.OrderBy(orderBy...).Limit(int(q.Size) + 1).All(dest); err != nil {
+		return nil, err
+	}
+
+	items := v.Elem()
+	more := uint(items.Len()) > q.Size
+	if more {
+		items.Set(items.Slice(0, int(q.Size)))
+	}
+	if cursor.Backward {
+		swap := reflect.Swapper(items.Interface())
+		for i, j := 0, items.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	info := &PageInfo{}
+	if items.Len() == 0 {
+		return info, nil
+	}
+
+	var err error
+	if (!cursor.Backward && more) || (cursor.Backward && q.Cursor != "") {
+		if info.Next, err = encodePageCursor(items.Index(items.Len()-1), columns, desc, false); err != nil {
+			return nil, err
+		}
+	}
+	if (cursor.Backward && more) || (!cursor.Backward && q.Cursor != "") {
+		if info.Prev, err = encodePageCursor(items.Index(0), columns, desc, true); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// pageOrder returns the ordering columns of a page followed by the primary
+// keys of the store that aren't already part of it.
+func (s *store) pageOrder(orderBy []string) ([]string, []bool) {
+	columns := make([]string, 0, len(orderBy))
+	desc := make([]bool, 0, len(orderBy))
+	seen := make(map[string]bool)
+	for _, column := range orderBy {
+		d := strings.HasPrefix(column, "-")
+		column = strings.TrimPrefix(column, "-")
+		columns = append(columns, column)
+		desc = append(desc, d)
+		seen[column] = true
+	}
+
+	if pk, ok := s.Collection.(hasPrimaryKeys); ok {
+		for _, pKey := range pk.PrimaryKeys() {
+			if !seen[pKey] {
+				columns = append(columns, pKey)
+				desc = append(desc, false)
+			}
+		}
+	}
+	return columns, desc
+}
+
+// keysetCond matches the items that come after values in the given order, or
+// before them when backward is set:
+//
+//	(a > ?) OR (a = ? AND b > ?) OR ...
+func keysetCond(columns []string, desc []bool, backward bool, values []interface{}) db.Compound {
+	conds := make([]db.Compound, 0, len(columns))
+	for i, column := range columns {
+		op := " >"
+		if desc[i] != backward {
+			op = " <"
+		}
+		cond := db.Cond{column + op: values[i]}
+		for j := 0; j < i; j++ {
+			cond[columns[j]] = values[j]
+		}
+		conds = append(conds, cond)
+	}
+	return db.Or(conds...)
+}
+
+// pageOrderKey returns the ordering of columns as stored in cursors.
+func pageOrderKey(columns []string, desc []bool) []string {
+	order := make([]string, len(columns))
+	for i, column := range columns {
+		if desc[i] {
+			column = "-" + column
+		}
+		order[i] = column
+	}
+	return order
+}
+
+func encodePageCursor(item reflect.Value, columns []string, desc []bool, backward bool) (string, error) {
+	fields := mapper.FieldsByName(reflect.Indirect(item), columns)
+
+	cursor := pageCursor{
+		Order:    pageOrderKey(columns, desc),
+		Values:   make([]json.RawMessage, len(fields)),
+		Backward: backward,
+	}
+	for i := range fields {
+		if !fields[i].IsValid() {
+			return "", ErrInvalidQuery
+		}
+		value, err := json.Marshal(fields[i].Interface())
+		if err != nil {
+			return "", err
+		}
+		cursor.Values[i] = value
+	}
+
+	buf, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// decodePageCursor decodes a cursor, it fails with ErrInvalidCursor if the
+// cursor was created with another ordering.
+func decodePageCursor(s string, columns []string, desc []bool) (pageCursor, error) {
+	var cursor pageCursor
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(buf, &cursor); err != nil || len(cursor.Values) != len(columns) {
+		return cursor, ErrInvalidCursor
+	}
+	order := pageOrderKey(columns, desc)
+	if len(cursor.Order) != len(order) {
+		return cursor, ErrInvalidCursor
+	}
+	for i := range order {
+		if cursor.Order[i] != order[i] {
+			return cursor, ErrInvalidCursor
+		}
+	}
+	return cursor, nil
+}
+
+// cursorValues decodes the values of a cursor into the types of the fields
+// mapped to the columns by the given item type, so they keep their type
+// through JSON, e.g. time.Time or int64.
+func cursorValues(itemType reflect.Type, columns []string, raw []json.RawMessage) ([]interface{}, error) {
+	for itemType.Kind() == reflect.Ptr {
+		itemType = itemType.Elem()
+	}
+	if itemType.Kind() != reflect.Struct {
+		return nil, ErrExpectingPointerToSlice
+	}
+
+	fields := mapper.FieldsByName(reflect.New(itemType).Elem(), columns)
+	values := make([]interface{}, len(fields))
+	for i := range fields {
+		if !fields[i].IsValid() {
+			return nil, ErrInvalidQuery
+		}
+		value := reflect.New(fields[i].Type())
+		if err := json.Unmarshal(raw[i], value.Interface()); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values[i] = value.Elem().Interface()
+	}
+	return values, nil
+}
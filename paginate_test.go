@@ -0,0 +1,84 @@
+package bond_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/db.v3"
+)
+
+func TestPage(t *testing.T) {
+	dbReset()
+
+	// Messages repeat so ids break the ties.
+	for _, message := range []string{"b", "a", "c", "a", "b"} {
+		assert.NoError(t, DB.Save(&Log{Message: message}))
+	}
+
+	messages := func(logs []Log) []string {
+		out := make([]string, len(logs))
+		for i := range logs {
+			out[i] = logs[i].Message
+		}
+		return out
+	}
+
+	q := bond.PageQuery{OrderBy: []string{"message"}, Size: 2}
+
+	var logs []Log
+	page, err := DB.Log.Page(&logs, q)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "a"}, messages(logs))
+	assert.Empty(t, page.Prev)
+	assert.NotEmpty(t, page.Next)
+
+	q.Cursor = page.Next
+	page, err = DB.Log.Page(&logs, q)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "b"}, messages(logs))
+	assert.True(t, logs[0].ID < logs[1].ID)
+	assert.NotEmpty(t, page.Prev)
+	assert.NotEmpty(t, page.Next)
+
+	q.Cursor = page.Next
+	page, err = DB.Log.Page(&logs, q)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c"}, messages(logs))
+	assert.Empty(t, page.Next)
+
+	q.Cursor = page.Prev
+	page, err = DB.Log.Page(&logs, q)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "b"}, messages(logs))
+
+	q.Cursor = page.Prev
+	page, err = DB.Log.Page(&logs, q)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "a"}, messages(logs))
+	assert.Empty(t, page.Prev)
+
+	q = bond.PageQuery{Cond: db.Cond{"message <>": "c"}, OrderBy: []string{"-message"}, Size: 3}
+	page, err = DB.Log.Page(&logs, q)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "b", "a"}, messages(logs))
+
+	q.Cursor = page.Next
+	_, err = DB.Log.Page(&logs, q)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, messages(logs))
+
+	// Cursors are rejected under another ordering, even one with as many
+	// columns.
+	q.OrderBy = []string{"message"}
+	_, err = DB.Log.Page(&logs, q)
+	assert.Equal(t, bond.ErrInvalidCursor, err)
+
+	q.OrderBy = []string{"-id"}
+	_, err = DB.Log.Page(&logs, q)
+	assert.Equal(t, bond.ErrInvalidCursor, err)
+
+	q.Cursor = "garbage"
+	_, err = DB.Log.Page(&logs, q)
+	assert.Equal(t, bond.ErrInvalidCursor, err)
+}
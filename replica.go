@@ -0,0 +1,183 @@
+package bond
+
+import (
+	"database/sql"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"upper.io/db.v3"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+// ReplicaSelector picks the replica that is going to be used to run a read
+// query. It is never called with an empty list of replicas.
+type ReplicaSelector func(replicas []Backend) Backend
+
+// RoundRobin returns a ReplicaSelector that cycles through all replicas.
+func RoundRobin() ReplicaSelector {
+	var next uint64
+	return func(replicas []Backend) Backend {
+		n := atomic.AddUint64(&next, 1) - 1
+		return replicas[n%uint64(len(replicas))]
+	}
+}
+
+// LeastLoaded is a ReplicaSelector that picks the replica with the least
+// number of connections in use.
+func LeastLoaded(replicas []Backend) Backend {
+	best, bestInUse := replicas[0], -1
+	for _, replica := range replicas {
+		inUse := 0
+		if sqlDB, ok := replica.Driver().(*sql.DB); ok {
+			inUse = sqlDB.Stats().InUse
+		}
+		if bestInUse < 0 || inUse < bestInUse {
+			best, bestInUse = replica, inUse
+		}
+	}
+	return best
+}
+
+type hasReplicas interface {
+	replica() Backend
+}
+
+// OpenWithReplicas connects to a primary database and to a set of read
+// replicas, see NewWithReplicas.
+func OpenWithReplicas(adapter string, primary db.ConnectionURL, replicas ...db.ConnectionURL) (Session, error) {
+	conn, err := sqlbuilder.Open(adapter, primary)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaConns := make([]Backend, 0, len(replicas))
+	for _, url := range replicas {
+		replicaConn, err := sqlbuilder.Open(adapter, url)
+		if err != nil {
+			for i := range replicaConns {
+				replicaConns[i].Close()
+			}
+			conn.Close()
+			return nil, err
+		}
+		replicaConns = append(replicaConns, replicaConn)
+	}
+
+	return NewWithReplicas(conn, RoundRobin(), replicaConns...), nil
+}
+
+// NewWithReplicas returns a new session that sends reads made with Store.Find
+// to one of the given replicas, the replica is chosen by selector (RoundRobin
+// if nil). Writes and everything that happens within a transaction are sent
+// to the primary.
+func NewWithReplicas(primary Backend, selector ReplicaSelector, replicas ...Backend) Session {
+	if selector == nil {
+		selector = RoundRobin()
+	}
+	return &session{
+		Backend:       primary,
+		stores:        make(map[string]*store),
+		replicas:      replicas,
+		selectReplica: selector,
+		scopes:        newScopes(),
+		tableRefs:     newTableRefs(),
+	}
+}
+
+// Primary returns a copy of the session that sends all queries to the
+// primary, use it to read data right after writing it. The copy keeps the
+// replicas, so closing it closes them too.
+func (s *session) Primary() Session {
+	sess := s.clone(s.Backend)
+	sess.selectReplica = nil
+	return sess
+}
+
+func (s *session) replica() Backend {
+	if len(s.replicas) == 0 || s.selectReplica == nil {
+		return nil
+	}
+	return s.selectReplica(s.replicas)
+}
+
+// Close closes the primary and all the replicas, even if some of them fail to
+// close.
+func (s *session) Close() error {
+	var err error
+	for _, backend := range append([]Backend{s.Backend}, s.replicas...) {
+		if cErr := backend.Close(); cErr != nil {
+			if err == nil {
+				err = cErr
+			} else {
+				err = errors.Wrap(err, cErr.Error())
+			}
+		}
+	}
+	return err
+}
+
+// replicaResult is a result set that reads from a replica and writes to the
+// primary.
+type replicaResult struct {
+	db.Result
+
+	primary db.Result
+}
+
+var _ db.Result = &replicaResult{}
+
+func (r *replicaResult) Limit(n int) db.Result {
+	return &replicaResult{Result: r.Result.Limit(n), primary: r.primary.Limit(n)}
+}
+
+func (r *replicaResult) Offset(n int) db.Result {
+	return &replicaResult{Result: r.Result.Offset(n), primary: r.primary.Offset(n)}
+}
+
+func (r *replicaResult) OrderBy(v ...interface{}) db.Result {
+	return &replicaResult{Result: r.Result.OrderBy(v...), primary: r.primary.OrderBy(v...)}
+}
+
+func (r *replicaResult) Select(v ...interface{}) db.Result {
+	return &replicaResult{Result: r.Result.Select(v...), primary: r.primary.Select(v...)}
+}
+
+func (r *replicaResult) Where(v ...interface{}) db.Result {
+	return &replicaResult{Result: r.Result.Where(v...), primary: r.primary.Where(v...)}
+}
+
+func (r *replicaResult) And(v ...interface{}) db.Result {
+	return &replicaResult{Result: r.Result.And(v...), primary: r.primary.And(v...)}
+}
+
+func (r *replicaResult) Group(v ...interface{}) db.Result {
+	return &replicaResult{Result: r.Result.Group(v...), primary: r.primary.Group(v...)}
+}
+
+func (r *replicaResult) Paginate(pageSize uint) db.Result {
+	return &replicaResult{Result: r.Result.Paginate(pageSize), primary: r.primary.Paginate(pageSize)}
+}
+
+func (r *replicaResult) Page(pageNumber uint) db.Result {
+	return &replicaResult{Result: r.Result.Page(pageNumber), primary: r.primary.Page(pageNumber)}
+}
+
+func (r *replicaResult) Cursor(cursorColumn string) db.Result {
+	return &replicaResult{Result: r.Result.Cursor(cursorColumn), primary: r.primary.Cursor(cursorColumn)}
+}
+
+func (r *replicaResult) NextPage(cursorValue interface{}) db.Result {
+	return &replicaResult{Result: r.Result.NextPage(cursorValue), primary: r.primary.NextPage(cursorValue)}
+}
+
+func (r *replicaResult) PrevPage(cursorValue interface{}) db.Result {
+	return &replicaResult{Result: r.Result.PrevPage(cursorValue), primary: r.primary.PrevPage(cursorValue)}
+}
+
+func (r *replicaResult) Update(v interface{}) error {
+	return r.primary.Update(v)
+}
+
+func (r *replicaResult) Delete() error {
+	return r.primary.Delete()
+}
@@ -0,0 +1,63 @@
+package bond_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/db.v3"
+	"upper.io/db.v3/postgresql"
+)
+
+func TestReplicas(t *testing.T) {
+	// The replica is the test database with the tenant_a schema in its
+	// search_path, so rows written to the primary's accounts aren't there.
+	replicaSettings := connSettings
+	replicaSettings.Options = map[string]string{"search_path": "tenant_a"}
+
+	sess, err := bond.OpenWithReplicas(postgresql.Adapter, connSettings, replicaSettings)
+	assert.NoError(t, err)
+	defer sess.Close()
+
+	acct := &Account{Name: "Replicated"}
+	err = sess.Save(acct)
+	assert.NoError(t, err)
+
+	// Reads go to the replica.
+	var acctChk Account
+	err = sess.Store("accounts").Find(db.Cond{"id": acct.ID}).One(&acctChk)
+	assert.Equal(t, db.ErrNoMoreRows, err)
+
+	err = sess.Primary().Store("accounts").Find(db.Cond{"id": acct.ID}).One(&acctChk)
+	assert.NoError(t, err)
+	assert.Equal(t, acct.Name, acctChk.Name)
+
+	// Writes on replica result sets go to the primary.
+	err = sess.Store("accounts").Find(db.Cond{"id": acct.ID}).Update(db.Cond{"name": "Updated"})
+	assert.NoError(t, err)
+
+	// Transactions run on the primary.
+	err = sess.SessionTx(nil, func(tx bond.Session) error {
+		return tx.Store("accounts").Find(db.Cond{"id": acct.ID}).One(&acctChk)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Updated", acctChk.Name)
+
+	err = sess.Store("accounts").Find(db.Cond{"id": acct.ID}).Delete()
+	assert.NoError(t, err)
+
+	count, err := sess.Primary().Store("accounts").Find(db.Cond{"id": acct.ID}).Count()
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestReplicasClose(t *testing.T) {
+	sess, err := bond.OpenWithReplicas(postgresql.Adapter, connSettings, connSettings)
+	assert.NoError(t, err)
+
+	// Closing a primary-only copy closes the replicas too.
+	assert.NoError(t, sess.Primary().Close())
+
+	_, err = sess.Store("accounts").Find().Count()
+	assert.Error(t, err)
+}
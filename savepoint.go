@@ -0,0 +1,70 @@
+package bond
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+// WithSavepoints returns a copy of the given transaction session on which
+// nested transactions are savepoints: SessionTx and NewSessionTx open a
+// savepoint within the transaction, TxCommit releases it and TxRollback rolls
+// back to it. Committing or rolling back the returned session itself ends the
+// transaction as usual.
+func WithSavepoints(sess Session) (Session, error) {
+	s, ok := sess.(*session)
+	if !ok {
+		return nil, errors.Errorf("bond: unsupported session type %T", sess)
+	}
+	if _, ok := s.Backend.(sqlbuilder.Tx); !ok {
+		return nil, errors.Errorf("bond: session is not a tx")
+	}
+	c := s.clone(s.Backend)
+	c.savepoints = new(uint64)
+	return c, nil
+}
+
+// newSavepoint opens a savepoint and returns a copy of the session bound to
+// it.
+func (s *session) newSavepoint() (*session, error) {
+	name := fmt.Sprintf("bond_savepoint_%d", atomic.AddUint64(s.savepoints, 1))
+	if _, err := s.Exec("SAVEPOINT " + name); err != nil {
+		return nil, err
+	}
+	sess := s.clone(s.Backend)
+	sess.savepoint = name
+	sess.identityMap = s.identityMap.child()
+	return sess, nil
+}
+
+func (s *session) releaseSavepoint() error {
+	_, err := s.Exec("RELEASE SAVEPOINT " + s.savepoint)
+	if err == nil {
+		s.identityMap.commit()
+	}
+	return err
+}
+
+func (s *session) rollbackSavepoint() error {
+	defer s.identityMap.rollback()
+	_, err := s.Exec("ROLLBACK TO SAVEPOINT " + s.savepoint)
+	return err
+}
+
+// savepointTx runs fn within a savepoint, the savepoint is released if fn
+// returns nil and rolled back otherwise.
+func (s *session) savepointTx(fn func(sess Session) error) error {
+	sess, err := s.newSavepoint()
+	if err != nil {
+		return err
+	}
+	if err := fn(sess); err != nil {
+		if rErr := sess.rollbackSavepoint(); rErr != nil {
+			return errors.Wrap(err, rErr.Error())
+		}
+		return err
+	}
+	return sess.releaseSavepoint()
+}
@@ -0,0 +1,60 @@
+package bond_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/bond/bondtest"
+	"upper.io/db.v3"
+)
+
+func TestSavepoints(t *testing.T) {
+	t.Run("group", func(t *testing.T) {
+		for i := 0; i < 4; i++ {
+			prefix := fmt.Sprintf("Savepoint %d ", i)
+			t.Run(prefix, func(t *testing.T) {
+				t.Parallel()
+				tx := bondtest.Tx(t, DB)
+
+				err := tx.SessionTx(nil, func(outer bond.Session) error {
+					if err := outer.Save(&Account{Name: prefix + "outer"}); err != nil {
+						return err
+					}
+					err := outer.SessionTx(nil, func(inner bond.Session) error {
+						if err := inner.Save(&Account{Name: prefix + "rolled back"}); err != nil {
+							return err
+						}
+						return errors.New("rolling back")
+					})
+					if err == nil {
+						return errors.New("expecting an error")
+					}
+					return outer.SessionTx(nil, func(inner bond.Session) error {
+						return inner.Save(&Account{Name: prefix + "inner"})
+					})
+				})
+				assert.NoError(t, err)
+
+				var names []string
+				var accts []Account
+				err = tx.Store("accounts").Find(db.Cond{"name LIKE": "Savepoint %"}).OrderBy("id").All(&accts)
+				assert.NoError(t, err)
+				for _, acct := range accts {
+					names = append(names, acct.Name)
+				}
+				// Rows written by the other subtests aren't visible.
+				assert.Equal(t, []string{prefix + "outer", prefix + "inner"}, names)
+
+				// Committing the test's session doesn't commit its transaction.
+				assert.NoError(t, tx.TxCommit())
+			})
+		}
+	})
+
+	count, err := DB.Store("accounts").Find(db.Cond{"name LIKE": "Savepoint %"}).Count()
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+}
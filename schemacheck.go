@@ -0,0 +1,204 @@
+package bond
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"upper.io/db.v3"
+	"upper.io/db.v3/lib/reflectx"
+)
+
+// ModelSpec describes the columns a model expects its collection to have.
+// Specs are usually built from models with SpecOf, but can be built from
+// other sources, like Go source files, to check models that aren't compiled
+// into the program.
+type ModelSpec struct {
+	Name        string
+	Collection  string
+	Columns     []ColumnSpec
+	PrimaryKeys []string // nil when the model doesn't declare its keys
+}
+
+// ColumnSpec is a column expected by a model. GoType is the type of the field
+// mapped to the column without pointers, with basic named types replaced by
+// their underlying type, e.g. "int64", "string", "time.Time" or "[]byte".
+// Columns of other types are not type checked.
+type ColumnSpec struct {
+	Name   string
+	GoType string
+}
+
+// SchemaProblem is a difference between a model and its collection.
+type SchemaProblem struct {
+	Model      string
+	Collection string
+	Column     string
+	Message    string
+}
+
+func (p SchemaProblem) String() string {
+	if p.Column == "" {
+		return fmt.Sprintf("%s (%s): %s", p.Model, p.Collection, p.Message)
+	}
+	return fmt.Sprintf("%s (%s.%s): %s", p.Model, p.Collection, p.Column, p.Message)
+}
+
+// CheckSchema compares the db-tagged fields of the given models against the
+// columns of their collections. It reports missing tables and columns, fields
+// whose types don't match their columns and primary keys that differ from
+// the ones declared by models implementing PrimaryKeys() []string.
+func CheckSchema(sess Session, models ...Model) ([]SchemaProblem, error) {
+	specs := make([]ModelSpec, 0, len(models))
+	for _, model := range models {
+		specs = append(specs, SpecOf(sess, model))
+	}
+	return CheckSpecs(sess, specs...)
+}
+
+// SpecOf returns the spec of the given model.
+func SpecOf(sess Session, model Model) ModelSpec {
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	spec := ModelSpec{
+		Name:       t.Name(),
+		Collection: model.Store(sess).Name(),
+		Columns:    columnSpecs(t),
+	}
+	if pk, ok := model.(hasPrimaryKeys); ok {
+		spec.PrimaryKeys = pk.PrimaryKeys()
+	}
+	return spec
+}
+
+// CheckSpecs compares model specs against the columns of their collections.
+func CheckSpecs(sess Session, specs ...ModelSpec) ([]SchemaProblem, error) {
+	var problems []SchemaProblem
+	for _, spec := range specs {
+		report := func(column, format string, args ...interface{}) {
+			problems = append(problems, SchemaProblem{
+				Model:      spec.Name,
+				Collection: spec.Collection,
+				Column:     column,
+				Message:    fmt.Sprintf(format, args...),
+			})
+		}
+
+		tables, err := Describe(sess, spec.Collection)
+		if err != nil {
+			if errors.Cause(err) == db.ErrCollectionDoesNotExist {
+				report("", "table does not exist")
+				continue
+			}
+			return nil, err
+		}
+		table := tables[0]
+
+		for _, c := range spec.Columns {
+			column := table.Column(c.Name)
+			if column == nil {
+				report(c.Name, "column does not exist")
+				continue
+			}
+			if !compatibleTypes(c.GoType, column.Type) {
+				report(c.Name, "field type %s does not match column type %s", c.GoType, column.Type)
+			}
+		}
+
+		for _, pKey := range table.PrimaryKey {
+			if !hasColumn(spec.Columns, pKey) {
+				report(pKey, "primary key column is not mapped by the model")
+			}
+		}
+		if spec.PrimaryKeys != nil && !equalStrings(spec.PrimaryKeys, table.PrimaryKey) {
+			report("", "model declares primary keys %v but the table has %v", spec.PrimaryKeys, table.PrimaryKey)
+		}
+	}
+	return problems, nil
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte{})
+)
+
+// columnSpecs returns the columns mapped by the fields of t, fields of
+// embedded and inline structs included.
+func columnSpecs(t reflect.Type) []ColumnSpec {
+	var columns []ColumnSpec
+	for _, fi := range columnFields(t) {
+		columns = append(columns, ColumnSpec{Name: fi.Name, GoType: goTypeName(reflectx.Deref(fi.Field.Type))})
+	}
+	return columns
+}
+
+func goTypeName(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "time.Time"
+	case t.ConvertibleTo(bytesType) && t.Kind() == reflect.Slice:
+		return "[]byte"
+	case t.Kind() <= reflect.Float64 || t.Kind() == reflect.String:
+		return t.Kind().String()
+	}
+	return t.String()
+}
+
+// compatibleTypes reports whether a field of the given Go type can hold a
+// column of the given database type. Unknown types are always compatible.
+func compatibleTypes(goType, dbType string) bool {
+	dbType = strings.ToLower(dbType)
+	if i := strings.IndexAny(dbType, "(["); i >= 0 {
+		dbType = strings.TrimSpace(dbType[:i])
+	}
+	has := func(words ...string) bool {
+		for _, w := range words {
+			if strings.Contains(dbType, w) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch goType {
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return has("int", "serial", "numeric", "decimal")
+	case "float32", "float64":
+		return has("int", "serial", "numeric", "decimal", "real", "double", "float")
+	case "bool":
+		return has("bool", "tinyint", "bit")
+	case "string":
+		return has("char", "text", "uuid", "enum", "user-defined", "json", "inet", "numeric", "decimal", "time", "date")
+	case "time.Time":
+		return has("time", "date")
+	case "[]byte":
+		return has("bytea", "blob", "binary", "json", "text", "char")
+	}
+	return true
+}
+
+func hasColumn(columns []ColumnSpec, name string) bool {
+	for _, c := range columns {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
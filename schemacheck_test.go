@@ -0,0 +1,52 @@
+package bond_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+)
+
+type driftedAccount struct {
+	ID        string    `db:"id,omitempty"`
+	Name      string    `db:"name"`
+	Plan      string    `db:"plan"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func (a *driftedAccount) Store(sess bond.Session) bond.Store {
+	return sess.Store("accounts")
+}
+
+func (a *driftedAccount) PrimaryKeys() []string {
+	return []string{"id", "name"}
+}
+
+type missingTable struct {
+	ID int64 `db:"id,omitempty"`
+}
+
+func (m *missingTable) Store(sess bond.Session) bond.Store {
+	return sess.Store("missing_table")
+}
+
+func TestCheckSchema(t *testing.T) {
+	problems, err := bond.CheckSchema(DB, &Account{}, &User{}, &Log{})
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+
+	problems, err = bond.CheckSchema(DB, &driftedAccount{}, &missingTable{})
+	assert.NoError(t, err)
+
+	messages := make([]string, 0, len(problems))
+	for _, p := range problems {
+		messages = append(messages, p.String())
+	}
+	assert.Equal(t, []string{
+		"driftedAccount (accounts.id): field type string does not match column type integer",
+		"driftedAccount (accounts.plan): column does not exist",
+		"driftedAccount (accounts): model declares primary keys [id name] but the table has [id]",
+		"missingTable (missing_table): table does not exist",
+	}, messages)
+}
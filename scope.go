@@ -0,0 +1,175 @@
+package bond
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"upper.io/db.v3"
+)
+
+// scopes holds the named conditions registered on stores, by collection. A
+// registry is shared by a session and every session derived from it.
+type scopes struct {
+	named    map[string]map[string]interface{}
+	defaults map[string][]string
+	mu       sync.RWMutex
+}
+
+func newScopes() *scopes {
+	return &scopes{
+		named:    make(map[string]map[string]interface{}),
+		defaults: make(map[string][]string),
+	}
+}
+
+type hasScopes interface {
+	scopeRegistry() *scopes
+}
+
+func (s *session) scopeRegistry() *scopes {
+	return s.scopes
+}
+
+func (r *scopes) set(collection, name string, cond interface{}, isDefault bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.named[collection] == nil {
+		r.named[collection] = make(map[string]interface{})
+	}
+	r.named[collection][name] = cond
+
+	if isDefault {
+		for _, n := range r.defaults[collection] {
+			if n == name {
+				return
+			}
+		}
+		r.defaults[collection] = append(r.defaults[collection], name)
+	}
+}
+
+// Scope registers a named condition on the store's collection, replacing any
+// scope with the same name, and returns the store. Scopes are shared by every
+// session derived from the same session and are applied with Scoped. A nil
+// condition matches every item:
+//
+//	accounts := sess.Store("accounts").Scope("active", db.Cond{"disabled": false})
+//	accounts.Scoped("active").Find(db.Cond{"name": "Pressly"})
+func (s *store) Scope(name string, cond interface{}) Store {
+	if r := s.scopeRegistry(); r != nil {
+		r.set(s.name, name, cond, false)
+	}
+	return s
+}
+
+// DefaultScope registers a named scope that Find applies to every query of
+// the collection, unless the store is Unscoped.
+func (s *store) DefaultScope(name string, cond interface{}) Store {
+	if r := s.scopeRegistry(); r != nil {
+		r.set(s.name, name, cond, true)
+	}
+	return s
+}
+
+// Scoped returns a copy of the store whose Find applies the given named
+// scopes on top of the ones already applied. Scopes are looked up when the
+// store queries the database, the queries of a store with a scope that isn't
+// registered by then fail with an error whose cause is ErrUnknownScope.
+func (s *store) Scoped(names ...string) Store {
+	scoped := append(append([]string{}, s.scoped...), names...)
+	return s.withScopes(scoped, s.unscoped)
+}
+
+// Unscoped returns a copy of the store whose Find doesn't apply default
+// scopes, named scopes can still be applied with Scoped.
+func (s *store) Unscoped() Store {
+	return s.withScopes(s.scoped, true)
+}
+
+func (s *store) withScopes(scoped []string, unscoped bool) *store {
+	c := *s
+	c.scoped = scoped
+	c.unscoped = unscoped
+	return &c
+}
+
+func (s *store) scopeRegistry() *scopes {
+	if hs, ok := s.session.(hasScopes); ok {
+		return hs.scopeRegistry()
+	}
+	return nil
+}
+
+// scopeConds returns the conditions of the default scopes, unless the store
+// is unscoped, followed by the ones of the scopes applied with Scoped. Nil
+// conditions are left out.
+func (s *store) scopeConds() ([]interface{}, error) {
+	r := s.scopeRegistry()
+	if r == nil {
+		if len(s.scoped) > 0 {
+			return nil, errors.Wrapf(ErrUnknownScope, "bond: %q of %s", s.scoped[0], s.name)
+		}
+		return nil, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var conds []interface{}
+	add := func(name string) error {
+		cond, ok := r.named[s.name][name]
+		if !ok {
+			return errors.Wrapf(ErrUnknownScope, "bond: %q of %s", name, s.name)
+		}
+		if cond != nil {
+			conds = append(conds, cond)
+		}
+		return nil
+	}
+	if !s.unscoped {
+		for _, name := range r.defaults[s.name] {
+			if err := add(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, name := range s.scoped {
+		if err := add(name); err != nil {
+			return nil, err
+		}
+	}
+	return conds, nil
+}
+
+// errResult is a result set that fails with err.
+type errResult struct {
+	err error
+}
+
+var _ db.Result = errResult{}
+
+func (r errResult) String() string                   { return "" }
+func (r errResult) Limit(int) db.Result              { return r }
+func (r errResult) Offset(int) db.Result             { return r }
+func (r errResult) OrderBy(...interface{}) db.Result { return r }
+func (r errResult) Select(...interface{}) db.Result  { return r }
+func (r errResult) Where(...interface{}) db.Result   { return r }
+func (r errResult) And(...interface{}) db.Result     { return r }
+func (r errResult) Group(...interface{}) db.Result   { return r }
+func (r errResult) Delete() error                    { return r.err }
+func (r errResult) Update(interface{}) error         { return r.err }
+func (r errResult) Count() (uint64, error)           { return 0, r.err }
+func (r errResult) Exists() (bool, error)            { return false, r.err }
+func (r errResult) Next(interface{}) bool            { return false }
+func (r errResult) Err() error                       { return r.err }
+func (r errResult) One(interface{}) error            { return r.err }
+func (r errResult) All(interface{}) error            { return r.err }
+func (r errResult) Paginate(uint) db.Result          { return r }
+func (r errResult) Page(uint) db.Result              { return r }
+func (r errResult) Cursor(string) db.Result          { return r }
+func (r errResult) NextPage(interface{}) db.Result   { return r }
+func (r errResult) PrevPage(interface{}) db.Result   { return r }
+func (r errResult) TotalPages() (uint, error)        { return 0, r.err }
+func (r errResult) TotalEntries() (uint64, error)    { return 0, r.err }
+func (r errResult) Close() error                     { return nil }
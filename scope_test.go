@@ -0,0 +1,82 @@
+package bond_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/db.v3"
+)
+
+func TestScopes(t *testing.T) {
+	dbReset()
+
+	for _, message := range []string{"info: one", "debug: two", "info: three"} {
+		assert.NoError(t, DB.Save(&Log{Message: message}))
+	}
+
+	// A new session, so scopes don't leak into other tests.
+	sess := bond.New(DB.Conn())
+	logs := sess.Store("logs").
+		Scope("info", db.Cond{"message LIKE": "info:%"}).
+		Scope("one", db.Cond{"message LIKE": "%one"})
+
+	count, err := logs.Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), count)
+
+	count, err = logs.Scoped("info").Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), count)
+
+	count, err = logs.Scoped("info", "one").Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+
+	// Scopes are looked up by queries, unknown scopes fail them.
+	missing := logs.Scoped("missing")
+	_, err = missing.Find().Count()
+	assert.Equal(t, bond.ErrUnknownScope, errors.Cause(err))
+
+	var log Log
+	err = missing.Find().One(&log)
+	assert.Equal(t, bond.ErrUnknownScope, errors.Cause(err))
+
+	logs.Scope("missing", db.Cond{"message LIKE": "debug:%"})
+	count, err = missing.Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+
+	// Nil conditions match every item.
+	count, err = logs.Scope("all", nil).Scoped("all").Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), count)
+
+	// Scopes are shared by derived sessions.
+	tx, err := sess.NewSessionTx(nil)
+	assert.NoError(t, err)
+	defer tx.TxRollback()
+
+	count, err = tx.Store("logs").Scoped("info").Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), count)
+
+	tx.Store("logs").DefaultScope("hidden", db.Cond{"message NOT LIKE": "debug:%"})
+
+	count, err = sess.Store("logs").Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), count)
+
+	count, err = sess.Store("logs").Unscoped().Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), count)
+
+	count, err = sess.Store("logs").Unscoped().Scoped("one").Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+
+	count, err = sess.Store("logs").Scoped("one").WithSession(tx).Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+}
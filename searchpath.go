@@ -0,0 +1,62 @@
+package bond
+
+import (
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// WithSchema returns a copy of the session that works on the given PostgreSQL
+// schema: the collections of stores are qualified with the schema, while store
+// names aren't, and Describe and AutoMigrate look tables up in the schema.
+// Stores are cached per schema, a store of one schema is never returned to a
+// session of another.
+//
+// The search_path is only set within transactions: every transaction started
+// from the session sets it to the schema, so raw SQL within the transaction
+// sees the schema's tables too. Raw SQL run outside a transaction uses the
+// connection's search_path and does NOT see the schema's tables, qualify them
+// or run the query within SessionTx.
+func (s *session) WithSchema(schema string) Session {
+	sess := s.clone(s.Backend)
+	sess.schema = schema
+	return sess
+}
+
+type hasSchema interface {
+	schemaName() string
+}
+
+func (s *session) schemaName() string {
+	return s.schema
+}
+
+// qualifiedTable returns the schema and the table of the given name, the
+// schema is the session's schema unless name is qualified.
+func qualifiedTable(sess Session, name string) (schema, table string) {
+	if i := strings.Index(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	if hs, ok := sess.(hasSchema); ok {
+		return hs.schemaName(), name
+	}
+	return "", name
+}
+
+// qualifiedName prefixes the given collection name with the session's schema,
+// names that are already qualified are left untouched.
+func (s *session) qualifiedName(collectionName string) string {
+	if s.schema == "" || strings.Contains(collectionName, ".") {
+		return collectionName
+	}
+	return s.schema + "." + collectionName
+}
+
+// setSearchPath sets the search_path of the session's transaction.
+func (s *session) setSearchPath() error {
+	if s.schema == "" {
+		return nil
+	}
+	_, err := s.Exec("SELECT set_config('search_path', ?, true)", pq.QuoteIdentifier(s.schema))
+	return err
+}
@@ -0,0 +1,53 @@
+package bond_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/db.v3"
+)
+
+func TestSchema(t *testing.T) {
+	sess := DB.WithSchema("tenant_a")
+
+	assert.Equal(t, "accounts", sess.Store("accounts").Name())
+	assert.NotEqual(t, DB.Store("accounts"), sess.Store("accounts"))
+
+	// Tables are described within the schema.
+	tables, err := bond.Describe(sess, "accounts")
+	assert.NoError(t, err)
+	if assert.Len(t, tables, 1) {
+		assert.Equal(t, "accounts", tables[0].Name)
+		assert.Equal(t, []string{"id"}, tables[0].PrimaryKey)
+	}
+
+	_, err = bond.Describe(sess, "tenant_a.accounts")
+	assert.NoError(t, err)
+
+	acct := &Account{Name: "In tenant_a"}
+	err = sess.Save(acct)
+	assert.NoError(t, err)
+
+	count, err := sess.Store("accounts").Find(db.Cond{"name": acct.Name}).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+
+	count, err = DB.Store("accounts").Find(db.Cond{"name": acct.Name}).Count()
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+
+	// Raw SQL within a transaction uses the schema's search_path.
+	err = sess.SessionTx(nil, func(tx bond.Session) error {
+		row, err := tx.QueryRow("SELECT COUNT(1) FROM accounts WHERE name = ?", acct.Name)
+		if err != nil {
+			return err
+		}
+		return row.Scan(&count)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+
+	err = sess.Delete(acct)
+	assert.NoError(t, err)
+}
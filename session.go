@@ -44,6 +44,9 @@ type Session interface {
 	Backend
 
 	Conn() sqlbuilder.Database
+	Primary() Session
+	ForTenant(id interface{}, opts ...TenantOption) Session
+	WithSchema(schema string) Session
 
 	Store(collectionName string) Store
 	ResolveStore(interface{}) Store
@@ -54,7 +57,18 @@ type Session interface {
 	WithContext(context.Context) Session
 	Context() context.Context
 
+	WithObserver(QueryObserver) Session
+	WithCache(Cache) Session
+	WithIdentityMap() Session
+
+	WithNotifications() Session
+	Subscribe(ctx context.Context, collectionName string) (<-chan ChangeEvent, error)
+
 	SessionTx(context.Context, func(tx Session) error) error
+	UnitOfWork(context.Context, func(uow *UnitOfWork) error) error
+
+	WithAdvisoryLock(ctx context.Context, name string, fn func(sess Session) error) error
+	TryAdvisoryLock(ctx context.Context, name string, fn func(sess Session) error) (bool, error)
 	NewTx(context.Context) (sqlbuilder.Tx, error)
 	NewSessionTx(context.Context) (Session, error)
 
@@ -67,6 +81,27 @@ type session struct {
 
 	stores map[string]*store
 	mu     sync.Mutex
+
+	notify bool
+
+	replicas      []Backend
+	selectReplica ReplicaSelector
+
+	tenant *tenant
+	schema string
+
+	savepoints *uint64
+	savepoint  string
+
+	observer QueryObserver
+
+	scopes    *scopes
+	tableRefs *tableRefs
+
+	cache   Cache
+	pending *pendingInvalidations
+
+	identityMap *identityMap
 }
 
 // Open connects to a database.
@@ -82,28 +117,72 @@ func Open(adapter string, url db.ConnectionURL) (Session, error) {
 
 // New returns a new session.
 func New(conn Backend) Session {
-	return &session{Backend: conn, stores: make(map[string]*store)}
+	return &session{Backend: conn, stores: make(map[string]*store), scopes: newScopes(), tableRefs: newTableRefs()}
+}
+
+// clone returns a copy of the session that uses the given backend and keeps
+// the settings of the original session.
+func (s *session) clone(backend Backend) *session {
+	sess := &session{
+		Backend: backend,
+		stores:  make(map[string]*store),
+		notify:  s.notify,
+		tenant:  s.tenant,
+		schema:  s.schema,
+
+		observer:  s.observer,
+		scopes:    s.scopes,
+		tableRefs: s.tableRefs,
+		cache:     s.cache,
+
+		identityMap: s.identityMap,
+	}
+	if _, ok := backend.(sqlbuilder.Tx); ok {
+		sess.savepoints = s.savepoints
+		sess.savepoint = s.savepoint
+
+		// Cache invalidations wait for the transaction to be committed.
+		sess.pending = s.pending
+		if sess.pending == nil && s.cache != nil {
+			sess.pending = &pendingInvalidations{}
+		}
+
+		// So do the items it adds to the identity map.
+		if _, ok := s.Backend.(sqlbuilder.Tx); !ok {
+			sess.identityMap = s.identityMap.child()
+		}
+	} else {
+		// Transactions always run on the primary.
+		sess.replicas = s.replicas
+		sess.selectReplica = s.selectReplica
+	}
+	return sess
 }
 
 func (s *session) Conn() sqlbuilder.Database {
 	return s.Backend.(sqlbuilder.Database)
 }
 
-func (s *session) WithContext(ctx context.Context) Session {
-	var backendCtx Backend
-	switch t := s.Backend.(type) {
+func backendWithContext(backend Backend, ctx context.Context) Backend {
+	switch t := backend.(type) {
 	case databaseWithContext:
-		backendCtx = t.WithContext(ctx)
+		return t.WithContext(ctx)
 	case txWithContext:
-		backendCtx = t.WithContext(ctx)
-	default:
-		panic("Bad session")
+		return t.WithContext(ctx)
 	}
+	panic("Bad session")
+}
 
-	return &session{
-		Backend: backendCtx,
-		stores:  make(map[string]*store),
+func (s *session) WithContext(ctx context.Context) Session {
+	ctx = s.observedContext(ctx)
+	sess := s.clone(backendWithContext(s.Backend, ctx))
+	if len(sess.replicas) > 0 {
+		sess.replicas = make([]Backend, len(s.replicas))
+		for i := range s.replicas {
+			sess.replicas[i] = backendWithContext(s.replicas[i], ctx)
+		}
 	}
+	return sess
 }
 
 func (s *session) Context() context.Context {
@@ -132,22 +211,40 @@ func Bind(adapter string, backend SQLBackend) (Session, error) {
 		return nil, fmt.Errorf("Unknown backend type: %T", t)
 	}
 
-	return &session{Backend: conn, stores: make(map[string]*store)}, nil
+	return &session{Backend: conn, stores: make(map[string]*store), scopes: newScopes(), tableRefs: newTableRefs()}, nil
 }
 
 func (s *session) NewTx(ctx context.Context) (sqlbuilder.Tx, error) {
-	return s.Conn().NewTx(ctx)
+	return s.Conn().NewTx(s.observedContext(ctx))
 }
 
 func (s *session) NewSessionTx(ctx context.Context) (Session, error) {
+	if s.savepoints != nil {
+		return s.newSavepoint()
+	}
 	tx, err := s.NewTx(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return &session{
-		Backend: tx,
-		stores:  make(map[string]*store),
-	}, nil
+	sess, err := s.txSession(tx)
+	if err != nil {
+		tx.Rollback()
+		tx.Close()
+		return nil, err
+	}
+	return sess, nil
+}
+
+// txSession returns a copy of the session bound to the given transaction.
+func (s *session) txSession(tx sqlbuilder.Tx) (*session, error) {
+	sess := s.clone(tx)
+	if err := sess.setSearchPath(); err != nil {
+		return nil, err
+	}
+	if err := sess.setTenant(); err != nil {
+		return nil, err
+	}
+	return sess, nil
 }
 
 func (s *session) TxCommit() error {
@@ -155,8 +252,13 @@ func (s *session) TxCommit() error {
 	if !ok {
 		return errors.Errorf("bond: session is not a tx")
 	}
+	if s.savepoint != "" {
+		return s.releaseSavepoint()
+	}
 	defer tx.Close()
-	return tx.Commit()
+	err := tx.Commit()
+	s.endTx(err == nil)
+	return err
 }
 
 func (s *session) TxRollback() error {
@@ -164,31 +266,68 @@ func (s *session) TxRollback() error {
 	if !ok {
 		return errors.Errorf("bond: session is not a tx")
 	}
+	if s.savepoint != "" {
+		return s.rollbackSavepoint()
+	}
 	defer tx.Close()
+	defer s.endTx(false)
 	return tx.Rollback()
 }
 
-func (s *session) SessionTx(ctx context.Context, fn func(sess Session) error) error {
-	txFn := func(sess sqlbuilder.Tx) error {
-		return fn(&session{
-			Backend: sess,
-			stores:  make(map[string]*store),
-		})
+// endTx settles what the session's transaction deferred until its end.
+func (s *session) endTx(committed bool) {
+	if committed {
+		s.flushInvalidations()
+		s.identityMap.commit()
+		return
+	}
+	s.identityMap.rollback()
+}
+
+func (s *session) SessionTx(ctx context.Context, fn func(sess Session) error) (err error) {
+	if o, ok := s.observer.(TxObserver); ok {
+		var end func(error)
+		ctx, end = o.StartTx(s.observedContext(ctx))
+		defer func() { end(err) }()
+
+		// Queries of the transaction carry the observer's context, even when
+		// the session is a transaction already.
+		s = s.WithContext(ctx).(*session)
+	}
+
+	var txSess *session
+	txFn := func(tx sqlbuilder.Tx) error {
+		sess, err := s.txSession(tx)
+		if err != nil {
+			return err
+		}
+		txSess = sess
+		return fn(sess)
 	}
 
 	switch t := s.Backend.(type) {
 	case sqlbuilder.Database:
-		return t.Tx(ctx, txFn)
+		err := t.Tx(s.observedContext(ctx), txFn)
+		if txSess != nil {
+			txSess.endTx(err == nil)
+		}
+		return err
 	case sqlbuilder.Tx:
+		if s.savepoints != nil {
+			return s.savepointTx(fn)
+		}
 		defer t.Close()
 		err := txFn(t)
 		if err != nil {
+			defer s.endTx(false)
 			if rErr := t.Rollback(); rErr != nil {
 				return errors.Wrap(err, rErr.Error())
 			}
 			return err
 		}
-		return t.Commit()
+		err = t.Commit()
+		s.endTx(err == nil)
+		return err
 	}
 
 	return errors.New("Missing backend, forgot to use bond.New?")
@@ -226,15 +365,19 @@ func (s *session) Store(collectionName string) Store {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if store, ok := s.stores[collectionName]; ok {
+	// Stores are cached by qualified name, so stores of different schemas
+	// never mix.
+	qualifiedName := s.qualifiedName(collectionName)
+	if store, ok := s.stores[qualifiedName]; ok {
 		return store
 	}
 
 	store := &store{
-		Collection: s.Collection(collectionName),
+		Collection: s.Collection(qualifiedName),
+		name:       collectionName,
 		session:    s,
 	}
-	s.stores[collectionName] = store
+	s.stores[qualifiedName] = store
 	return store
 }
 
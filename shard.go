@@ -0,0 +1,268 @@
+package bond
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"upper.io/db.v3"
+)
+
+// ShardKeyFunc returns the shard key of an item, the shard key decides which
+// shard the item is stored in.
+type ShardKeyFunc func(item interface{}) interface{}
+
+// GatherQuery describes a query that runs on all shards.
+type GatherQuery struct {
+	Conds   []interface{}
+	OrderBy []string
+	Limit   int
+	Offset  int
+}
+
+// ShardedSession distributes models across several sessions (shards) using a
+// shard key function per model type.
+type ShardedSession struct {
+	shards []Session
+
+	keys map[reflect.Type]ShardKeyFunc
+	mu   sync.RWMutex
+}
+
+// NewSharded returns a sharded session that uses the given shards, the order
+// of the shards must not change between runs. It fails with ErrMissingShards
+// when no shard is given.
+func NewSharded(shards ...Session) (*ShardedSession, error) {
+	if len(shards) == 0 {
+		return nil, ErrMissingShards
+	}
+	return &ShardedSession{
+		shards: shards,
+		keys:   make(map[reflect.Type]ShardKeyFunc),
+	}, nil
+}
+
+// Register sets the shard key function for the type of the given model.
+func (s *ShardedSession) Register(model Model, fn ShardKeyFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[reflect.TypeOf(model)] = fn
+}
+
+// Shards returns all shards.
+func (s *ShardedSession) Shards() []Session {
+	return s.shards
+}
+
+// ShardFor returns the shard that owns the given shard key. Integer keys are
+// distributed by modulo, any other key is hashed.
+func (s *ShardedSession) ShardFor(key interface{}) Session {
+	n := uint64(len(s.shards))
+
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		if i < 0 {
+			i = -i
+		}
+		return s.shards[uint64(i)%n]
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return s.shards[v.Uint()%n]
+	}
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%v", key)
+	return s.shards[h.Sum64()%n]
+}
+
+// ShardOf returns the shard the given item belongs to.
+func (s *ShardedSession) ShardOf(item Model) (Session, error) {
+	if item == nil {
+		return nil, ErrExpectingNonNilModel
+	}
+
+	s.mu.RLock()
+	fn, ok := s.keys[reflect.TypeOf(item)]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrMissingShardKey
+	}
+
+	return s.ShardFor(fn(item)), nil
+}
+
+// Save saves the item on its shard.
+func (s *ShardedSession) Save(item Model) error {
+	sess, err := s.ShardOf(item)
+	if err != nil {
+		return err
+	}
+	return sess.Save(item)
+}
+
+// Delete deletes the item from its shard.
+func (s *ShardedSession) Delete(item Model) error {
+	sess, err := s.ShardOf(item)
+	if err != nil {
+		return err
+	}
+	return sess.Delete(item)
+}
+
+// Find returns a result set on the shard that owns the given shard key.
+func (s *ShardedSession) Find(key interface{}, collectionName string, conds ...interface{}) db.Result {
+	return s.ShardFor(key).Store(collectionName).Find(conds...)
+}
+
+// Close closes all shards.
+func (s *ShardedSession) Close() error {
+	var firstErr error
+	for i := range s.shards {
+		if err := s.shards[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Gather runs the query on every shard and merges all results into dest,
+// which must be a pointer to a slice. Results are merged following the
+// query's ordering before the limit and offset are applied.
+func (s *ShardedSession) Gather(collectionName string, q GatherQuery, dest interface{}) error {
+	destv := reflect.ValueOf(dest)
+	if destv.Kind() != reflect.Ptr || destv.Elem().Kind() != reflect.Slice {
+		return ErrExpectingPointerToSlice
+	}
+	sliceType := destv.Elem().Type()
+
+	results := make([]reflect.Value, len(s.shards))
+	errs := make([]error, len(s.shards))
+
+	var wg sync.WaitGroup
+	for i := range s.shards {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			res := s.shards[i].Store(collectionName).Find(q.Conds...)
+			if len(q.OrderBy) > 0 {
+				orderBy := make([]interface{}, len(q.OrderBy))
+				for j := range q.OrderBy {
+					orderBy[j] = q.OrderBy[j]
+				}
+				res = res.OrderBy(orderBy...)
+			}
+			if q.Limit > 0 {
+				res = res.Limit(q.Offset + q.Limit)
+			}
+
+			items := reflect.New(sliceType)
+			errs[i] = res.All(items.Interface())
+			results[i] = items.Elem()
+		}(i)
+	}
+	wg.Wait()
+
+	merged := reflect.MakeSlice(sliceType, 0, 0)
+	for i := range results {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		merged = reflect.AppendSlice(merged, results[i])
+	}
+
+	if len(q.OrderBy) > 0 {
+		sort.SliceStable(merged.Interface(), func(a, b int) bool {
+			return lessByColumns(merged.Index(a), merged.Index(b), q.OrderBy)
+		})
+	}
+
+	if q.Offset > 0 {
+		if q.Offset > merged.Len() {
+			q.Offset = merged.Len()
+		}
+		merged = merged.Slice(q.Offset, merged.Len())
+	}
+	if q.Limit > 0 && q.Limit < merged.Len() {
+		merged = merged.Slice(0, q.Limit)
+	}
+
+	destv.Elem().Set(merged)
+	return nil
+}
+
+// lessByColumns compares two items by the given columns, columns prefixed with
+// "-" are sorted in descending order.
+func lessByColumns(a, b reflect.Value, columns []string) bool {
+	for _, column := range columns {
+		desc := strings.HasPrefix(column, "-")
+		column = strings.TrimPrefix(column, "-")
+
+		c := compareValues(
+			mapper.FieldByName(reflect.Indirect(a), column),
+			mapper.FieldByName(reflect.Indirect(b), column),
+		)
+		if c == 0 {
+			continue
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	return false
+}
+
+func compareValues(a, b reflect.Value) int {
+	a, b = reflect.Indirect(a), reflect.Indirect(b)
+	if !a.IsValid() || !b.IsValid() {
+		switch {
+		case a.IsValid():
+			return 1
+		case b.IsValid():
+			return -1
+		}
+		return 0
+	}
+
+	if ta, ok := a.Interface().(time.Time); ok {
+		if tb, ok := b.Interface().(time.Time); ok {
+			switch {
+			case ta.Before(tb):
+				return -1
+			case ta.After(tb):
+				return 1
+			}
+			return 0
+		}
+	}
+
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(a.Int() < b.Int(), a.Int() > b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return compareOrdered(a.Uint() < b.Uint(), a.Uint() > b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return compareOrdered(a.Float() < b.Float(), a.Float() > b.Float())
+	case reflect.Bool:
+		return compareOrdered(!a.Bool() && b.Bool(), a.Bool() && !b.Bool())
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	}
+	return strings.Compare(fmt.Sprintf("%v", a.Interface()), fmt.Sprintf("%v", b.Interface()))
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,54 @@
+package bond_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/db.v3"
+)
+
+func TestSharded(t *testing.T) {
+	// Each schema of the test database plays the role of a shard.
+	_, err := bond.NewSharded()
+	assert.Equal(t, bond.ErrMissingShards, err)
+
+	sharded, err := bond.NewSharded(DB.WithSchema("public"), DB.WithSchema("tenant_a"))
+	assert.NoError(t, err)
+	sharded.Register(&Account{}, func(item interface{}) interface{} {
+		return item.(*Account).Name
+	})
+
+	names := []string{"Shard A", "Shard B", "Shard C", "Shard D", "Shard E"}
+	for _, name := range names {
+		err := sharded.Save(&Account{Name: name})
+		assert.NoError(t, err)
+	}
+
+	err = sharded.Save(&User{Username: "unsharded"})
+	assert.Equal(t, bond.ErrMissingShardKey, err)
+
+	var acct Account
+	err = sharded.Find("Shard C", "accounts", db.Cond{"name": "Shard C"}).One(&acct)
+	assert.NoError(t, err)
+	assert.Equal(t, "Shard C", acct.Name)
+
+	var accts []Account
+	err = sharded.Gather("accounts", bond.GatherQuery{
+		Conds:   []interface{}{db.Cond{"name LIKE": "Shard %"}},
+		OrderBy: []string{"-name"},
+		Limit:   2,
+		Offset:  1,
+	}, &accts)
+	assert.NoError(t, err)
+	if assert.Len(t, accts, 2) {
+		assert.Equal(t, "Shard D", accts[0].Name)
+		assert.Equal(t, "Shard C", accts[1].Name)
+	}
+
+	for _, name := range names {
+		shard := sharded.ShardFor(name)
+		err := shard.Store("accounts").Find(db.Cond{"name": name}).Delete()
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,61 @@
+package bond
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// SlogObserver logs queries with a slog.Logger. Failed queries are logged at
+// error level, queries slower than SlowThreshold at warn level and the rest
+// at debug level.
+type SlogObserver struct {
+	Logger        *slog.Logger
+	SlowThreshold time.Duration
+}
+
+// NewSlogObserver returns an observer that logs queries with logger, a nil
+// logger means slog.Default(). A zero threshold disables slow query
+// reporting.
+func NewSlogObserver(logger *slog.Logger, slowThreshold time.Duration) *SlogObserver {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogObserver{Logger: logger, SlowThreshold: slowThreshold}
+}
+
+// ObserveQuery logs e.
+func (o *SlogObserver) ObserveQuery(e *QueryEvent) {
+	level, msg := slog.LevelDebug, "bond: query"
+	switch {
+	case e.Err != nil:
+		level, msg = slog.LevelError, "bond: query failed"
+	case o.SlowThreshold > 0 && e.Duration >= o.SlowThreshold:
+		level, msg = slog.LevelWarn, "bond: slow query"
+	}
+
+	ctx := e.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !o.Logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("query", e.Query),
+		slog.Any("args", e.Args),
+		slog.Duration("duration", e.Duration),
+		slog.Int64("rows_affected", e.RowsAffected),
+	}
+	if e.Collection != "" {
+		attrs = append(attrs, slog.String("collection", e.Collection))
+	}
+	if e.Model != "" {
+		attrs = append(attrs, slog.String("model", e.Model))
+	}
+	if e.Err != nil {
+		attrs = append(attrs, slog.Any("error", e.Err))
+	}
+	o.Logger.LogAttrs(ctx, level, msg, attrs...)
+}
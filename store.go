@@ -2,12 +2,52 @@ package bond
 
 import (
 	"reflect"
+	"sort"
+
 	"upper.io/db.v3"
 	"upper.io/db.v3/lib/reflectx"
+	"upper.io/db.v3/lib/sqlbuilder"
 )
 
 var mapper = reflectx.NewMapper("db")
 
+// columnFields returns the fields of t that the mapper maps to columns, in
+// declaration order. Fields of structs that are embedded without a name or
+// tagged inline are columns of t, as with upper.io/db.
+func columnFields(t reflect.Type) []*reflectx.FieldInfo {
+	var fields []*reflectx.FieldInfo
+next:
+	for _, fi := range mapper.TypeMap(t).Index {
+		if fi.Name == "" || inlined(fi) {
+			continue
+		}
+		for p := fi.Parent; p.Parent != nil; p = p.Parent {
+			if !inlined(p) {
+				continue next
+			}
+		}
+		fields = append(fields, fi)
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		a, b := fields[i].Index, fields[j].Index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return fields
+}
+
+func inlined(fi *reflectx.FieldInfo) bool {
+	if reflectx.Deref(fi.Field.Type).Kind() != reflect.Struct {
+		return false
+	}
+	_, inline := fi.Options["inline"]
+	return inline || (fi.Embedded && fi.Field.Tag.Get("db") == "")
+}
+
 type hasPrimaryKeys interface {
 	PrimaryKeys() []string
 }
@@ -22,12 +62,38 @@ type Store interface {
 	Delete(interface{}) error
 	Create(interface{}) error
 	Update(interface{}) error
+
+	Iterate(cond interface{}, fn interface{}) error
+	Page(dest interface{}, q PageQuery) (*PageInfo, error)
+
+	Scope(name string, cond interface{}) Store
+	DefaultScope(name string, cond interface{}) Store
+	Scoped(names ...string) Store
+	Unscoped() Store
+
+	Get(dest interface{}, keys ...interface{}) error
+	Cached(key string, dest interface{}, conds ...interface{}) error
+
+	FindForUpdate(conds ...interface{}) (sqlbuilder.Selector, error)
+	FindLocked(mode LockMode, conds ...interface{}) (sqlbuilder.Selector, error)
 }
 
 type store struct {
 	db.Collection
 
+	name    string
 	session Session
+
+	scoped   []string
+	unscoped bool
+}
+
+// PrimaryKeys returns the primary keys of the store's collection.
+func (s *store) PrimaryKeys() []string {
+	if pk, ok := s.Collection.(hasPrimaryKeys); ok {
+		return pk.PrimaryKeys()
+	}
+	return nil
 }
 
 func (s *store) getPrimaryKeyFields(item interface{}) ([]string, []interface{}) {
@@ -47,17 +113,74 @@ func (s *store) getPrimaryKeyFields(item interface{}) ([]string, []interface{})
 // WithSession returns a copy of the store that runs in the context of the given
 // transaction.
 func (s *store) WithSession(sess Session) Store {
-	return &store{
-		Collection: sess.Collection(s.Collection.Name()),
-		session:    sess,
+	st := sess.Store(s.name)
+	if c, ok := st.(*store); ok && (s.scoped != nil || s.unscoped) {
+		return c.withScopes(s.scoped, s.unscoped)
 	}
+	return st
 }
 
-func (s *store) Save(item interface{}) error {
+// Name returns the name of the store's table, not qualified with the
+// session's schema.
+func (s *store) Name() string {
+	if s.name == "" && s.Collection != nil {
+		return s.Collection.Name()
+	}
+	return s.name
+}
+
+// Find returns a result set for the given conditions, restricted by the
+// store's scopes. When the store's session has read replicas the result set
+// reads from one of them.
+func (s *store) Find(conds ...interface{}) db.Result {
+	scopeConds, err := s.scopeConds()
+	if err != nil {
+		return errResult{err}
+	}
+
+	tenantCond, err := s.tenantCond()
+	if err != nil {
+		return errResult{err}
+	}
+
+	res := s.collection(nil).Find(conds...)
+	if r, ok := s.session.(hasReplicas); ok {
+		if replica := r.replica(); replica != nil {
+			var c db.Collection = replica.Collection(s.Collection.Name())
+			if o, ok := s.session.(hasObserver); ok && o.queryObserver() != nil {
+				c = o.originCollection(replica, s.Collection.Name(), nil)
+			}
+			res = &replicaResult{
+				Result:  c.Find(conds...),
+				primary: res,
+			}
+		}
+	}
+	if tenantCond != nil {
+		res = res.And(tenantCond)
+	}
+	if len(scopeConds) > 0 {
+		res = res.And(scopeConds...)
+	}
+	if s.identities() != nil {
+		res = &identityResult{Result: res, store: s}
+	}
+	return res
+}
+
+func (s *store) Save(item interface{}) (err error) {
+	s, end := s.startOp("save", item)
+	defer func() { end(err) }()
+
 	if saver, ok := item.(HasSave); ok {
-		return s.Session().SessionTx(nil, func(tx Session) error {
-			return saver.Save(tx)
+		err := s.Session().SessionTx(nil, func(tx Session) error {
+			return s.WithSession(tx).(*store).runHook("Save", item, saver.Save)
 		})
+		if err != nil {
+			return err
+		}
+		s.invalidateCache()
+		return nil
 	}
 
 	if s.Collection == nil {
@@ -68,69 +191,109 @@ func (s *store) Save(item interface{}) error {
 		return ErrExpectingPointerToStruct
 	}
 
+	if s.isNew(item) {
+		return s.Create(item)
+	}
+
+	return s.Update(item)
+}
+
+// isNew reports whether item has no primary key values yet.
+func (s *store) isNew(item interface{}) bool {
 	_, fields := s.getPrimaryKeyFields(item)
-	isCreate := true
 	for i := range fields {
 		if fields[i] != reflect.Zero(reflect.TypeOf(fields[i])).Interface() {
-			isCreate = false
+			return false
 		}
 	}
+	return true
+}
 
-	if isCreate {
-		return s.Create(item)
+func (s *store) Create(item interface{}) (err error) {
+	s, end := s.startOp("create", item)
+	defer func() { end(err) }()
+
+	if s.Collection == nil {
+		return ErrInvalidCollection
 	}
 
-	return s.Update(item)
+	if err := s.beforeCreate(item); err != nil {
+		return err
+	}
+
+	if reflect.TypeOf(item).Kind() == reflect.Ptr {
+		if err := s.collection(item).InsertReturning(item); err != nil {
+			return err
+		}
+	} else {
+		if _, err := s.collection(item).Insert(item); err != nil {
+			return err
+		}
+	}
+
+	return s.afterCreate(item)
 }
 
-func (s *store) Create(item interface{}) error {
-	if s.Collection == nil {
-		return ErrInvalidCollection
+// beforeCreate prepares item to be inserted and runs its hooks.
+func (s *store) beforeCreate(item interface{}) error {
+	if err := s.stampTenant(item); err != nil {
+		return err
 	}
 
 	if validator, ok := item.(HasValidate); ok {
-		if err := validator.Validate(); err != nil {
+		validate := func(Session) error { return validator.Validate() }
+		if err := s.runHook("Validate", item, validate); err != nil {
 			return err
 		}
 	}
 
 	if m, ok := item.(HasBeforeCreate); ok {
-		if err := m.BeforeCreate(s.session); err != nil {
+		if err := s.runHook("BeforeCreate", item, m.BeforeCreate); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	if reflect.TypeOf(item).Kind() == reflect.Ptr {
-		if err := s.Collection.InsertReturning(item); err != nil {
-			return err
-		}
-	} else {
-		if _, err := s.Collection.Insert(item); err != nil {
-			return err
-		}
+// afterCreate publishes the creation of item and runs its hooks.
+func (s *store) afterCreate(item interface{}) error {
+	if err := s.notify(ChangeCreate, item); err != nil {
+		return err
+	}
+	s.invalidateCache()
+	if im := s.identities(); im != nil {
+		im.sync(s, reflect.ValueOf(item))
 	}
 
 	if m, ok := item.(HasAfterCreate); ok {
-		if err := m.AfterCreate(s.session); err != nil {
+		if err := s.runHook("AfterCreate", item, m.AfterCreate); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (s *store) Update(item interface{}) error {
+func (s *store) Update(item interface{}) (err error) {
+	s, end := s.startOp("update", item)
+	defer func() { end(err) }()
+
 	if s.Collection == nil {
 		return ErrInvalidCollection
 	}
 
+	if err := s.checkTenant(item); err != nil {
+		return err
+	}
+
 	if validator, ok := item.(HasValidate); ok {
-		if err := validator.Validate(); err != nil {
+		validate := func(Session) error { return validator.Validate() }
+		if err := s.runHook("Validate", item, validate); err != nil {
 			return err
 		}
 	}
 
 	if m, ok := item.(HasBeforeUpdate); ok {
-		if err := m.BeforeUpdate(s.session); err != nil {
+		if err := s.runHook("BeforeUpdate", item, m.BeforeUpdate); err != nil {
 			return err
 		}
 	}
@@ -144,18 +307,30 @@ func (s *store) Update(item interface{}) error {
 		return ErrZeroItemID
 	}
 
-	if reflect.TypeOf(item).Kind() == reflect.Ptr {
-		if err := s.Collection.UpdateReturning(item); err != nil {
+	if s.tenant() != nil {
+		if err := s.tenantUpdate(item, cond); err != nil {
+			return err
+		}
+	} else if reflect.TypeOf(item).Kind() == reflect.Ptr {
+		if err := s.collection(item).UpdateReturning(item); err != nil {
 			return err
 		}
 	} else {
-		if err := s.Collection.Find(cond).Update(item); err != nil {
+		if err := s.collection(item).Find(cond).Update(item); err != nil {
 			return err
 		}
 	}
 
+	if err := s.notify(ChangeUpdate, item); err != nil {
+		return err
+	}
+	s.invalidateCache()
+	if im := s.identities(); im != nil {
+		im.sync(s, reflect.ValueOf(item))
+	}
+
 	if m, ok := item.(HasAfterUpdate); ok {
-		if err := m.AfterUpdate(s.session); err != nil {
+		if err := s.runHook("AfterUpdate", item, m.AfterUpdate); err != nil {
 			return err
 		}
 	}
@@ -163,7 +338,10 @@ func (s *store) Update(item interface{}) error {
 	return nil
 }
 
-func (s *store) Delete(item interface{}) error {
+func (s *store) Delete(item interface{}) (err error) {
+	s, end := s.startOp("delete", item)
+	defer func() { end(err) }()
+
 	if s.Collection == nil {
 		return ErrInvalidCollection
 	}
@@ -182,17 +360,29 @@ func (s *store) Delete(item interface{}) error {
 	}
 
 	if m, ok := item.(HasBeforeDelete); ok {
-		if err := m.BeforeDelete(s.session); err != nil {
+		if err := s.runHook("BeforeDelete", item, m.BeforeDelete); err != nil {
 			return err
 		}
 	}
 
-	if err := s.Collection.Find(cond).Delete(); err != nil {
+	if s.tenant() != nil {
+		if err := s.tenantDelete(cond); err != nil {
+			return err
+		}
+	} else if err := s.collection(item).Find(cond).Delete(); err != nil {
 		return err
 	}
 
+	if err := s.notify(ChangeDelete, item); err != nil {
+		return err
+	}
+	s.invalidateCache()
+	if im := s.identities(); im != nil {
+		im.remove(s, reflect.ValueOf(item))
+	}
+
 	if m, ok := item.(HasAfterDelete); ok {
-		if err := m.AfterDelete(s.session); err != nil {
+		if err := s.runHook("AfterDelete", item, m.AfterDelete); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,234 @@
+package bond
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"upper.io/db.v3"
+)
+
+// DefaultTenantColumn is the column that identifies the tenant a row belongs
+// to, unless a different one is given with TenantColumn.
+var DefaultTenantColumn = "account_id"
+
+type tenant struct {
+	id      interface{}
+	column  string
+	setting string
+	exclude map[string]bool
+}
+
+// TenantOption configures a tenant session.
+type TenantOption func(*tenant)
+
+// TenantColumn sets the column that identifies the tenant a row belongs to.
+func TenantColumn(column string) TenantOption {
+	return func(t *tenant) {
+		t.column = column
+	}
+}
+
+// TenantSetting sets a PostgreSQL run-time parameter (e.g. "app.tenant_id") to
+// the tenant ID at the beginning of every transaction started from the tenant
+// session, the parameter is local to the transaction and can be used by
+// row-level security policies.
+func TenantSetting(name string) TenantOption {
+	return func(t *tenant) {
+		t.setting = name
+	}
+}
+
+// TenantExclude lists collections that are shared by all tenants and must not
+// be scoped.
+func TenantExclude(collectionNames ...string) TenantOption {
+	return func(t *tenant) {
+		for _, name := range collectionNames {
+			t.exclude[name] = true
+		}
+	}
+}
+
+type hasTenant interface {
+	tenantScope() *tenant
+}
+
+// ForTenant returns a copy of the session in which stores only see and modify
+// rows that belong to the given tenant: Find is restricted to the tenant's
+// rows, Create stamps the tenant column and Update and Delete fail with
+// ErrTenantMismatch on rows of other tenants. Stores of a session with a nil
+// tenant ID fail with ErrMissingTenantID.
+func (s *session) ForTenant(id interface{}, opts ...TenantOption) Session {
+	t := &tenant{
+		id:      id,
+		column:  DefaultTenantColumn,
+		exclude: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	sess := s.clone(s.Backend)
+	sess.tenant = t
+	return sess
+}
+
+func (s *session) tenantScope() *tenant {
+	return s.tenant
+}
+
+// setTenant sets the tenant's run-time parameter on the session's transaction.
+func (s *session) setTenant() error {
+	if s.tenant == nil || s.tenant.setting == "" {
+		return nil
+	}
+	_, err := s.Exec("SELECT set_config(?, ?, true)", s.tenant.setting, fmt.Sprintf("%v", s.tenant.id))
+	return err
+}
+
+// tenant returns the tenant the store is scoped to, if any.
+func (s *store) tenant() *tenant {
+	if ht, ok := s.session.(hasTenant); ok {
+		if t := ht.tenantScope(); t != nil && !t.exclude[s.name] {
+			return t
+		}
+	}
+	return nil
+}
+
+// tenantCond returns the condition that restricts a query to the tenant's
+// rows, it fails with ErrMissingTenantID if the tenant ID is nil.
+func (s *store) tenantCond() (db.Cond, error) {
+	t := s.tenant()
+	if t == nil {
+		return nil, nil
+	}
+	if t.id == nil {
+		return nil, ErrMissingTenantID
+	}
+	return db.Cond{t.column: t.id}, nil
+}
+
+// tenantField returns the tenant field of item and the tenant ID converted to
+// its type.
+func (s *store) tenantField(t *tenant, item interface{}) (reflect.Value, reflect.Value, error) {
+	field := mapper.FieldByName(reflect.Indirect(reflect.ValueOf(item)), t.column)
+	if !field.IsValid() {
+		return field, field, ErrMissingTenantField
+	}
+
+	id := reflect.ValueOf(t.id)
+	if !id.IsValid() {
+		return field, id, ErrMissingTenantID
+	}
+	if !id.Type().ConvertibleTo(field.Type()) {
+		return field, id, fmt.Errorf("Cannot convert tenant ID %v to %v", t.id, field.Type())
+	}
+	return field, id.Convert(field.Type()), nil
+}
+
+// stampTenant sets the tenant column of item to the tenant ID, it fails if
+// item already belongs to another tenant.
+func (s *store) stampTenant(item interface{}) error {
+	t := s.tenant()
+	if t == nil {
+		return nil
+	}
+
+	field, id, err := s.tenantField(t, item)
+	if err != nil {
+		return err
+	}
+
+	if field.IsZero() {
+		if !field.CanSet() {
+			return ErrExpectingPointerToStruct
+		}
+		field.Set(id)
+		return nil
+	}
+
+	if field.Interface() != id.Interface() {
+		return ErrTenantMismatch
+	}
+	return nil
+}
+
+// checkTenant fails if item belongs to another tenant, unlike stampTenant it
+// leaves item as it is.
+func (s *store) checkTenant(item interface{}) error {
+	t := s.tenant()
+	if t == nil {
+		return nil
+	}
+
+	field, id, err := s.tenantField(t, item)
+	if err != nil {
+		return err
+	}
+	if !field.IsZero() && field.Interface() != id.Interface() {
+		return ErrTenantMismatch
+	}
+	return nil
+}
+
+// tenantUpdate updates the tenant's row matched by cond with item and reloads
+// item, it fails with ErrTenantMismatch if the row belongs to another tenant.
+// The tenant column is stamped on a copy of item, so that item is left as it
+// was when the update fails.
+func (s *store) tenantUpdate(item interface{}, cond db.Compound) error {
+	tenantCond, err := s.tenantCond()
+	if err != nil {
+		return err
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(item))
+	stamped := reflect.New(v.Type())
+	stamped.Elem().Set(v)
+	if err := s.stampTenant(stamped.Interface()); err != nil {
+		return err
+	}
+
+	res, err := s.session.Update(s.Collection.Name()).
+		Set(stamped.Interface()).
+		Where(db.And(cond, tenantCond)).
+		Exec()
+	if err := tenantAffected(res, err); err != nil {
+		return err
+	}
+	if reflect.TypeOf(item).Kind() == reflect.Ptr {
+		return s.collection(item).Find(cond).One(item)
+	}
+	return nil
+}
+
+// tenantDelete deletes the tenant's row matched by cond, it fails with
+// ErrTenantMismatch if the row belongs to another tenant.
+func (s *store) tenantDelete(cond db.Compound) error {
+	tenantCond, err := s.tenantCond()
+	if err != nil {
+		return err
+	}
+	res, err := s.session.DeleteFrom(s.Collection.Name()).
+		Where(db.And(cond, tenantCond)).
+		Exec()
+	return tenantAffected(res, err)
+}
+
+// tenantAffected fails with ErrTenantMismatch when a statement restricted to
+// the tenant's rows didn't affect any. MySQL doesn't count rows updated to
+// their current values unless the client sets CLIENT_FOUND_ROWS
+// (clientFoundRows=true in the DSN).
+func tenantAffected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTenantMismatch
+	}
+	return nil
+}
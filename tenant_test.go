@@ -0,0 +1,88 @@
+package bond_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/db.v3"
+)
+
+func TestTenant(t *testing.T) {
+	tenantA := DB.ForTenant(int64(100), bond.TenantExclude("logs"))
+	tenantB := DB.ForTenant(int64(200), bond.TenantExclude("logs"))
+
+	// The tenant column is stamped on create.
+	userA := &User{Username: "tenant-a"}
+	err := tenantA.Save(userA)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), userA.AccountID)
+
+	userB := &User{Username: "tenant-b"}
+	err = tenantB.Save(userB)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(200), userB.AccountID)
+
+	// Items that belong to another tenant can't be created.
+	err = tenantA.Save(&User{Username: "tenant-x", AccountID: 200})
+	assert.Equal(t, bond.ErrTenantMismatch, err)
+
+	// Finds only see the tenant's rows.
+	var users []User
+	err = tenantA.Store("users").Find(db.Cond{"username LIKE": "tenant-%"}).All(&users)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, "tenant-a", users[0].Username)
+
+	count, err := tenantB.Store("users").Find(userA.ID).Count()
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+
+	// Rows of other tenants can't be modified.
+	userB.AccountID = 0
+	err = tenantA.Save(userB)
+	assert.Equal(t, bond.ErrTenantMismatch, err)
+	assert.Zero(t, userB.AccountID, "a failed update leaves the item as it was")
+
+	err = tenantA.Delete(&User{ID: userB.ID})
+	assert.Equal(t, bond.ErrTenantMismatch, err)
+
+	var stored User
+	err = DB.Store("users").Find(userB.ID).One(&stored)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(200), stored.AccountID)
+	assert.Equal(t, "tenant-b", stored.Username)
+
+	// A nil tenant ID is an error, not a scope on rows without a tenant.
+	tenantNil := DB.ForTenant(nil)
+	err = tenantNil.Save(&User{Username: "tenant-nil"})
+	assert.Equal(t, bond.ErrMissingTenantID, err)
+
+	none := User{Username: "tenant-none"}
+	row, err := DB.QueryRow(`INSERT INTO users (username) VALUES (?) RETURNING id`, none.Username)
+	assert.NoError(t, err)
+	assert.NoError(t, row.Scan(&none.ID))
+
+	users = nil
+	err = tenantNil.Store("users").Find(db.Cond{"username": "tenant-none"}).All(&users)
+	assert.Equal(t, bond.ErrMissingTenantID, err)
+	assert.Empty(t, users)
+
+	err = tenantNil.Save(&none)
+	assert.Equal(t, bond.ErrMissingTenantID, err)
+
+	err = tenantNil.Delete(&none)
+	assert.Equal(t, bond.ErrMissingTenantID, err)
+
+	err = DB.Store("users").Find(none.ID).Delete()
+	assert.NoError(t, err)
+
+	// The tenant scope is kept within transactions.
+	err = tenantB.SessionTx(nil, func(tx bond.Session) error {
+		return tx.Delete(&User{ID: userB.ID})
+	})
+	assert.NoError(t, err)
+
+	err = tenantA.Delete(userA)
+	assert.NoError(t, err)
+}
@@ -21,3 +21,19 @@ CREATE TABLE logs (
   id serial primary key,
 	message VARCHAR
 );
+
+DROP SCHEMA IF EXISTS tenant_a CASCADE;
+
+CREATE SCHEMA tenant_a;
+
+CREATE TABLE tenant_a.accounts (
+  id serial primary key,
+  name varchar(256),
+  disabled boolean,
+  created_at timestamp with time zone
+);
+
+CREATE TABLE tenant_a.logs (
+  id serial primary key,
+  message VARCHAR
+);
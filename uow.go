@@ -0,0 +1,415 @@
+package bond
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+// UnitOfWork collects the writes of a unit of work, see Session.UnitOfWork.
+type UnitOfWork struct {
+	sess Session
+	refs *tableRefs
+
+	ops       []*uowOp
+	byItem    map[Model]*uowOp
+	snapshots map[Model]reflect.Value
+}
+
+type uowOp struct {
+	item   Model
+	delete bool
+}
+
+// UnitOfWork runs fn within a transaction and defers the writes it makes
+// with uow.Save and uow.Delete until fn returns. The writes are then flushed
+// in one go, and the transaction is committed, unless fn or a write fails.
+//
+// At flush time items are created, then updated, collection by collection
+// with referenced collections first, then deleted in the reverse order.
+// Collections are ordered by the foreign keys of the database when they can
+// be introspected, and by the order of the first write otherwise. Items of a
+// collection are created with a single multi-row insert on PostgreSQL and one
+// by one elsewhere. Updates of items passed to uow.Track that didn't change
+// are skipped, items loaded through uow.Session() aren't tracked unless they're
+// passed to uow.Track and are always updated. Every hook runs at flush time,
+// so BeforeCreate hooks can copy the primary keys of items created before
+// them.
+//
+// The foreign keys of the database are introspected within the transaction
+// and cached by the session.
+func (s *session) UnitOfWork(ctx context.Context, fn func(uow *UnitOfWork) error) error {
+	return s.SessionTx(ctx, func(tx Session) error {
+		uow := &UnitOfWork{
+			sess:      tx,
+			refs:      s.tableRefs,
+			byItem:    make(map[Model]*uowOp),
+			snapshots: make(map[Model]reflect.Value),
+		}
+		if err := fn(uow); err != nil {
+			return err
+		}
+		return uow.flush()
+	})
+}
+
+// Session returns the transaction of the unit of work, to read items. Reads
+// don't see the writes that weren't flushed yet.
+func (u *UnitOfWork) Session() Session {
+	return u.sess
+}
+
+// Track takes a snapshot of items, pointers to structs, so they're only
+// updated at flush time if they changed. Items that aren't tracked, including
+// the ones loaded through uow.Session(), are updated whenever they're saved.
+// The snapshot is shallow: changes made within slices, maps or pointed values
+// of an item go unnoticed.
+func (u *UnitOfWork) Track(items ...Model) {
+	for _, item := range items {
+		v := reflect.ValueOf(item)
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			continue
+		}
+		snapshot := reflect.New(v.Elem().Type()).Elem()
+		snapshot.Set(v.Elem())
+		u.snapshots[item] = snapshot
+	}
+}
+
+// Save schedules item to be created or updated at flush time.
+func (u *UnitOfWork) Save(item Model) error {
+	if err := checkUOWItem(item); err != nil {
+		return err
+	}
+	if op, ok := u.byItem[item]; ok {
+		op.delete = false
+		return nil
+	}
+	u.add(&uowOp{item: item})
+	return nil
+}
+
+// Delete schedules item to be deleted at flush time. Deleting an item whose
+// creation is scheduled cancels it.
+func (u *UnitOfWork) Delete(item Model) error {
+	if err := checkUOWItem(item); err != nil {
+		return err
+	}
+	if op, ok := u.byItem[item]; ok {
+		if s, ok := item.Store(u.sess).(*store); ok && !op.delete && s.isNew(item) {
+			delete(u.byItem, item)
+			for i := range u.ops {
+				if u.ops[i] == op {
+					u.ops = append(u.ops[:i], u.ops[i+1:]...)
+					break
+				}
+			}
+			return nil
+		}
+		op.delete = true
+		return nil
+	}
+	u.add(&uowOp{item: item, delete: true})
+	return nil
+}
+
+func checkUOWItem(item Model) error {
+	if item == nil {
+		return ErrExpectingNonNilModel
+	}
+	if v := reflect.ValueOf(item); v.Kind() != reflect.Ptr || v.IsNil() {
+		return ErrExpectingPointerToStruct
+	}
+	return nil
+}
+
+func (u *UnitOfWork) add(op *uowOp) {
+	u.ops = append(u.ops, op)
+	u.byItem[op.item] = op
+}
+
+// dirty reports whether item changed since it was tracked.
+func (u *UnitOfWork) dirty(item Model) bool {
+	snapshot, ok := u.snapshots[item]
+	if !ok {
+		return true
+	}
+	return !reflect.DeepEqual(snapshot.Interface(), reflect.ValueOf(item).Elem().Interface())
+}
+
+type uowCollection struct {
+	store   Store
+	creates []Model
+	updates []Model
+	deletes []Model
+}
+
+func (u *UnitOfWork) flush() error {
+	var names []string
+	collections := make(map[string]*uowCollection)
+
+	for _, op := range u.ops {
+		st := op.item.Store(u.sess)
+		if st == nil {
+			return ErrInvalidCollection
+		}
+		c, ok := collections[st.Name()]
+		if !ok {
+			c = &uowCollection{store: st}
+			collections[st.Name()] = c
+			names = append(names, st.Name())
+		}
+
+		switch {
+		case op.delete:
+			c.deletes = append(c.deletes, op.item)
+		case isNewItem(st, op.item):
+			c.creates = append(c.creates, op.item)
+		case u.dirty(op.item):
+			c.updates = append(c.updates, op.item)
+		}
+	}
+
+	names, err := dependencyOrder(u.sess, u.refs, names)
+	if err != nil {
+		return err
+	}
+
+	batch := false
+	if d, err := dialect(u.sess); err == nil && d == dialectPostgreSQL {
+		batch = true
+	}
+
+	for _, name := range names {
+		c := collections[name]
+		if err := createAll(c.store, c.creates, batch); err != nil {
+			return err
+		}
+		for _, item := range c.updates {
+			if err := u.save(c.store, item); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		c := collections[names[i]]
+		for _, item := range c.deletes {
+			if err := c.store.Delete(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// save saves an item that isn't new, through its own Save method if it has
+// one. Items of stores that can't tell new items apart are saved as well.
+func (u *UnitOfWork) save(st Store, item Model) error {
+	if _, ok := item.(HasSave); ok {
+		return st.Save(item)
+	}
+	if _, ok := st.(*store); !ok {
+		return st.Save(item)
+	}
+	return st.Update(item)
+}
+
+func isNewItem(st Store, item Model) bool {
+	s, ok := st.(*store)
+	if !ok || s.Collection == nil {
+		return false
+	}
+	if _, ok := s.Collection.(hasPrimaryKeys); !ok {
+		return false
+	}
+	return s.isNew(item)
+}
+
+// createAll creates items, with multi-row inserts when batch is set and the
+// items don't have their own Save method.
+func createAll(st Store, items []Model, batch bool) error {
+	s, ok := st.(*store)
+	var batched []interface{}
+	for _, item := range items {
+		if _, hasSave := item.(HasSave); hasSave || !ok || !batch {
+			if err := st.Save(item); err != nil {
+				return err
+			}
+			continue
+		}
+		batched = append(batched, item)
+	}
+	switch len(batched) {
+	case 0:
+		return nil
+	case 1:
+		return s.Create(batched[0])
+	}
+	return s.createBatch(batched)
+}
+
+// createBatch creates items with one INSERT ... RETURNING statement per set
+// of columns, running the hooks of every item.
+func (s *store) createBatch(items []interface{}) (err error) {
+	s, end := s.startOp("create_batch", items[0])
+	defer func() { end(err) }()
+
+	if s.Collection == nil {
+		return ErrInvalidCollection
+	}
+
+	for _, item := range items {
+		if err := s.beforeCreate(item); err != nil {
+			return err
+		}
+	}
+
+	// Items are grouped by type and by the columns they set, zero values of
+	// omitempty fields are left out.
+	type insert struct {
+		columns []string
+		values  [][]interface{}
+		items   []interface{}
+	}
+	var keys []string
+	inserts := make(map[string]*insert)
+	for _, item := range items {
+		columns, values, err := sqlbuilder.Map(item, nil)
+		if err != nil {
+			return err
+		}
+		key := reflect.TypeOf(item).String() + ":" + strings.Join(columns, ",")
+		ins, ok := inserts[key]
+		if !ok {
+			ins = &insert{columns: columns}
+			inserts[key] = ins
+			keys = append(keys, key)
+		}
+		ins.values = append(ins.values, values)
+		ins.items = append(ins.items, item)
+	}
+
+	for _, key := range keys {
+		ins := inserts[key]
+
+		q := s.session.InsertInto(s.Collection.Name()).Columns(ins.columns...)
+		for _, values := range ins.values {
+			q = q.Values(values...)
+		}
+
+		itemType := reflect.TypeOf(ins.items[0]).Elem()
+		rows := reflect.New(reflect.SliceOf(itemType))
+		if err := q.Returning("*").IteratorContext(s.session.Context()).All(rows.Interface()); err != nil {
+			return err
+		}
+		if rows.Elem().Len() != len(ins.items) {
+			return errors.Errorf("bond: inserted %d rows into %s, expected %d", rows.Elem().Len(), s.name, len(ins.items))
+		}
+		for i, item := range ins.items {
+			reflect.ValueOf(item).Elem().Set(rows.Elem().Index(i))
+		}
+	}
+
+	for _, item := range items {
+		if err := s.afterCreate(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableRefs caches the tables referenced by the foreign keys of tables, by
+// qualified table name.
+type tableRefs struct {
+	refs map[string][]string
+	mu   sync.Mutex
+}
+
+func newTableRefs() *tableRefs {
+	return &tableRefs{refs: make(map[string][]string)}
+}
+
+// lookup returns the tables referenced by the given tables, introspecting the
+// ones that aren't cached yet.
+func (c *tableRefs) lookup(sess Session, names []string) (map[string][]string, error) {
+	key := func(name string) string {
+		schema, table := qualifiedTable(sess, name)
+		return schema + "." + table
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var missing []string
+	for _, name := range names {
+		if _, ok := c.refs[key(name)]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		tables, err := Describe(sess, missing...)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tables {
+			refs := []string{}
+			for _, fk := range t.ForeignKeys {
+				if fk.RefTable != t.Name {
+					refs = append(refs, fk.RefTable)
+				}
+			}
+			c.refs[key(t.Name)] = refs
+		}
+	}
+
+	refs := make(map[string][]string, len(names))
+	for _, name := range names {
+		refs[name] = c.refs[key(name)]
+	}
+	return refs, nil
+}
+
+// dependencyOrder sorts collections so that the collections referenced by
+// the foreign keys of a collection come before it. The order is kept when
+// the dialect of the session can't be introspected.
+func dependencyOrder(sess Session, cache *tableRefs, names []string) ([]string, error) {
+	if len(names) < 2 {
+		return names, nil
+	}
+	if _, err := dialect(sess); err != nil {
+		return names, nil
+	}
+	if cache == nil {
+		cache = newTableRefs()
+	}
+	refs, err := cache.lookup(sess, names)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]string, 0, len(names))
+	visited := make(map[string]bool, len(names))
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, ref := range refs[name] {
+			for _, n := range names {
+				if n == ref {
+					visit(ref)
+				}
+			}
+		}
+		sorted = append(sorted, name)
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return sorted, nil
+}
@@ -0,0 +1,98 @@
+package bond_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"upper.io/bond"
+	"upper.io/db.v3"
+)
+
+type CountedLog struct {
+	ID      int64  `db:"id,omitempty"`
+	Message string `db:"message"`
+
+	creates int
+	updates int
+}
+
+func (l *CountedLog) Store(sess bond.Session) bond.Store {
+	return sess.Store("logs")
+}
+
+func (l *CountedLog) AfterCreate(sess bond.Session) error {
+	l.creates++
+	return nil
+}
+
+func (l *CountedLog) AfterUpdate(sess bond.Session) error {
+	l.updates++
+	return nil
+}
+
+func TestUnitOfWork(t *testing.T) {
+	dbReset()
+
+	logs := []*CountedLog{{Message: "one"}, {Message: "two"}, {Message: "three"}}
+	err := DB.UnitOfWork(nil, func(uow *bond.UnitOfWork) error {
+		for _, l := range logs {
+			assert.NoError(t, uow.Save(l))
+		}
+		// Writes are deferred until the end of the unit of work.
+		count, err := uow.Session().Store("logs").Find().Count()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(0), count)
+
+		// Deleting a new item cancels its creation.
+		return uow.Delete(logs[2])
+	})
+	assert.NoError(t, err)
+
+	for _, l := range logs[:2] {
+		assert.NotZero(t, l.ID)
+		assert.Equal(t, 1, l.creates)
+	}
+	assert.Zero(t, logs[2].ID)
+
+	count, err := DB.Log.Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), count)
+
+	err = DB.UnitOfWork(nil, func(uow *bond.UnitOfWork) error {
+		uow.Track(logs[0], logs[1])
+		logs[0].Message = "changed"
+		assert.NoError(t, uow.Save(logs[0]))
+		assert.NoError(t, uow.Save(logs[1]))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, logs[0].updates)
+	assert.Equal(t, 0, logs[1].updates)
+
+	var l CountedLog
+	assert.NoError(t, DB.Log.Find(db.Cond{"id": logs[0].ID}).One(&l))
+	assert.Equal(t, "changed", l.Message)
+
+	// Nothing is written when the unit of work fails.
+	fail := errors.New("fail")
+	err = DB.UnitOfWork(nil, func(uow *bond.UnitOfWork) error {
+		assert.NoError(t, uow.Delete(logs[0]))
+		assert.NoError(t, uow.Save(&CountedLog{Message: "four"}))
+		return fail
+	})
+	assert.Equal(t, fail, err)
+
+	count, err = DB.Log.Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), count)
+
+	err = DB.UnitOfWork(nil, func(uow *bond.UnitOfWork) error {
+		return uow.Delete(logs[0])
+	})
+	assert.NoError(t, err)
+
+	count, err = DB.Log.Find().Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+}